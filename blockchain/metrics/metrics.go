@@ -0,0 +1,365 @@
+// Package metrics collects counters, gauges and histograms and renders them in the Prometheus text format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default histogram buckets, in seconds, suited to request latencies
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds every metric exposed by one /metrics endpoint
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, registered := range r.metrics {
+		if registered.name() == m.name() {
+			panic(fmt.Sprintf("metric '%s' is already registered", m.name()))
+		}
+	}
+
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText renders every registered metric, sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name() < metrics[j].name()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+type desc struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (d desc) name() string {
+	return d.metricName
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, d.kind)
+}
+
+// series is the value of a metric for one combination of label values
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// vec stores the series of a counter or gauge keyed by their label values
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newVec(name string, help string, kind string, labelNames []string) *vec {
+	return &vec{
+		desc:   desc{metricName: name, help: help, kind: kind, labelNames: labelNames},
+		series: make(map[string]*series),
+	}
+}
+
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric '%s' expects %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+// DeleteLabel removes the series whose label name has value, so the series of what is gone stop being exposed.
+// It reports how many series were removed
+func (v *vec) DeleteLabel(name string, value string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	index := -1
+	for i, labelName := range v.labelNames {
+		if labelName == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0
+	}
+
+	deleted := 0
+	for key, s := range v.series {
+		if s.labelValues[index] == value {
+			delete(v.series, key)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	for _, s := range sortedSeries(v.series) {
+		writeSample(w, v.metricName, v.labelNames, s.labelValues, s.value)
+	}
+}
+
+// Counter is a value that only goes up, partitioned by its labels
+type Counter struct {
+	*vec
+}
+
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{newVec(name, help, "counter", labelNames)}
+	r.register(c)
+
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter '%s' cannot decrease", c.metricName))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.get(labelValues).value += delta
+}
+
+// Gauge is a value that can go up and down, partitioned by its labels
+type Gauge struct {
+	*vec
+}
+
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", labelNames)}
+	r.register(g)
+
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.get(labelValues).value = value
+}
+
+// valueFunc is a metric without labels whose value is read when the registry is rendered
+type valueFunc struct {
+	desc
+	fn func() float64
+}
+
+func (f *valueFunc) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	writeSample(w, f.metricName, nil, nil, f.fn())
+}
+
+// NewGaugeFunc exposes the value returned by fn as a gauge
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(&valueFunc{desc{metricName: name, help: help, kind: "gauge"}, fn})
+}
+
+// NewCounterFunc exposes the value returned by fn, which must never decrease, as a counter
+func (r *Registry) NewCounterFunc(name string, help string, fn func() float64) {
+	r.register(&valueFunc{desc{metricName: name, help: help, kind: "counter"}, fn})
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Histogram counts observations into cumulative buckets, partitioned by its labels
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, kind: "histogram", labelNames: labelNames},
+		buckets: sorted,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labelNames) {
+		panic(fmt.Sprintf("metric '%s' expects %d label values, got %d", h.metricName, len(h.labelNames), len(labelValues)))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bucketLabelNames := append(append([]string{}, h.labelNames...), "le")
+
+	for _, key := range keys {
+		s := h.series[key]
+
+		for i, upperBound := range h.buckets {
+			labelValues := append(append([]string{}, s.labelValues...), formatFloat(upperBound))
+			writeSample(w, h.metricName+"_bucket", bucketLabelNames, labelValues, float64(s.counts[i]))
+		}
+
+		labelValues := append(append([]string{}, s.labelValues...), "+Inf")
+		writeSample(w, h.metricName+"_bucket", bucketLabelNames, labelValues, float64(s.count))
+		writeSample(w, h.metricName+"_sum", h.labelNames, s.labelValues, s.sum)
+		writeSample(w, h.metricName+"_count", h.labelNames, s.labelValues, float64(s.count))
+	}
+}
+
+func sortedSeries(m map[string]*series) []*series {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		sorted = append(sorted, m[key])
+	}
+
+	return sorted
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames []string, labelValues []string, value float64) {
+	w.WriteString(name)
+
+	if len(labelNames) > 0 {
+		w.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labelName, escapeLabelValue(labelValues[i]))
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
@@ -0,0 +1,214 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+// Policy is the access rule applied to a route
+type Policy string
+
+const PolicyPublic = Policy("public")
+const PolicyAuthenticated = Policy("auth")
+
+// DefaultRoutePolicies protects the routes changing the ledger or the peers of the node
+var DefaultRoutePolicies = map[string]Policy{
+	endpointTxAdd:         PolicyAuthenticated,
+	endpointTxBatch:       PolicyAuthenticated,
+	endpointMempoolAdd:    PolicyAuthenticated,
+	endpointMempoolCommit: PolicyAuthenticated,
+	endpointBlock:         PolicyAuthenticated,
+	endpointTx:            PolicyAuthenticated,
+	endpointAddPeer:       PolicyAuthenticated,
+	endpointHandshake:     PolicyAuthenticated,
+	endpointSyncNow:       PolicyAuthenticated,
+}
+
+// DefaultRPCPolicies protects the JSON-RPC methods changing the ledger
+var DefaultRPCPolicies = map[string]Policy{
+	rpcMethodTxSubmit: PolicyAuthenticated,
+}
+
+type AuthConfig struct {
+	// API tokens accepted in the "Authorization: Bearer <token>" header
+	Tokens []string
+
+	// Secret shared by the nodes of a network to sign and verify requests
+	HMACSecret []byte
+
+	// Token presented to peers on their protected routes, such as when joining their known peers.
+	// It is only sent to the trusted peers, as the HMAC signatures are, see isTrustedPeer
+	PeerToken string
+
+	// Overrides of DefaultRoutePolicies and DefaultRPCPolicies
+	RoutePolicies map[string]Policy
+	RPCPolicies   map[string]Policy
+}
+
+// Enabled reports whether any credential is configured. Without one every route stays public
+func (a AuthConfig) Enabled() bool {
+	return len(a.Tokens) > 0 || len(a.HMACSecret) > 0
+}
+
+func (a AuthConfig) routePolicy(route string) Policy {
+	return policyOf(route, a.RoutePolicies, DefaultRoutePolicies)
+}
+
+func (a AuthConfig) rpcPolicy(method string) Policy {
+	return policyOf(method, a.RPCPolicies, DefaultRPCPolicies)
+}
+
+func policyOf(key string, overrides map[string]Policy, defaults map[string]Policy) Policy {
+	if policy, ok := overrides[key]; ok {
+		return policy
+	}
+
+	if policy, ok := defaults[key]; ok {
+		return policy
+	}
+
+	return PolicyPublic
+}
+
+// ParsePolicy reads a "route=policy" pair as given on the command line
+func ParsePolicy(raw string) (string, Policy, error) {
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid policy '%s', expected 'route=%s' or 'route=%s'", raw, PolicyPublic, PolicyAuthenticated)
+	}
+
+	policy := Policy(parts[1])
+	if policy != PolicyPublic && policy != PolicyAuthenticated {
+		return "", "", fmt.Errorf("unknown policy '%s', expected '%s' or '%s'", parts[1], PolicyPublic, PolicyAuthenticated)
+	}
+
+	return parts[0], policy, nil
+}
+
+type authenticatedKey struct{}
+
+// authenticate checks the credentials of r, if any, and rejects the request when route requires them.
+// Handlers serving several operations, like the JSON-RPC one, read the outcome with isAuthenticated
+func (n *Node) authenticate(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !n.auth.Enabled() {
+			handler(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey{}, true)))
+			return
+		}
+
+		err := n.checkCredentials(r)
+		if errors.Is(err, errBodyTooLarge) {
+			writeErrRes(w, err)
+			return
+		}
+
+		if err != nil && n.auth.routePolicy(route) == PolicyAuthenticated {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeErrResCode(w, fmt.Errorf("unauthorized. %s", err.Error()), http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), authenticatedKey{}, err == nil)))
+	}
+}
+
+func isAuthenticated(r *http.Request) bool {
+	authenticated, _ := r.Context().Value(authenticatedKey{}).(bool)
+
+	return authenticated
+}
+
+func (n *Node) checkCredentials(r *http.Request) error {
+	authorization := r.Header.Get(client.HeaderAuthorization)
+	if authorization != "" {
+		token := strings.TrimPrefix(authorization, "Bearer ")
+
+		for _, accepted := range n.auth.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(accepted)) == 1 {
+				return nil
+			}
+		}
+	}
+
+	if r.Header.Get(client.HeaderSignature) != "" {
+		if len(n.auth.HMACSecret) == 0 {
+			return fmt.Errorf("signed requests are not accepted by this node")
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("unable to read request body %w", err)
+		}
+		r.Body.Close()
+
+		// the handler reads the body once again
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+
+		err = client.VerifySignature(r, body, n.auth.HMACSecret, now)
+		if err != nil {
+			return err
+		}
+
+		// the timestamp was checked along with the signature
+		timestamp, _ := strconv.ParseInt(r.Header.Get(client.HeaderTimestamp), 10, 64)
+		if !n.signatureNonces.use(r.Header.Get(client.HeaderNonce), time.Unix(timestamp, 0).Add(client.MaxSignatureAge), now) {
+			return fmt.Errorf("replayed signature, the %s header was already used", client.HeaderNonce)
+		}
+
+		return nil
+	}
+
+	if authorization != "" {
+		return fmt.Errorf("invalid API token")
+	}
+
+	return fmt.Errorf("missing API token or signature")
+}
+
+// nonceCache remembers the nonces of the signed requests until their signature expires, so a signed request
+// captured on the way can't be replayed
+type nonceCache struct {
+	mu        sync.Mutex
+	expiries  map[string]time.Time
+	nextPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expiries: make(map[string]time.Time)}
+}
+
+// use records nonce until expiry. It reports false if nonce was already used by a signature still valid
+func (c *nonceCache) use(nonce string, expiry time.Time, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.nextPrune) {
+		for used, usedExpiry := range c.expiries {
+			if now.After(usedExpiry) {
+				delete(c.expiries, used)
+			}
+		}
+		c.nextPrune = now.Add(client.MaxSignatureAge)
+	}
+
+	if usedExpiry, ok := c.expiries[nonce]; ok && !now.After(usedExpiry) {
+		return false
+	}
+
+	c.expiries[nonce] = expiry
+
+	return true
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Requests are authenticated either with an API token in the Authorization header,
+// or signed with a secret shared by the nodes of a network
+const HeaderAuthorization = "Authorization"
+const HeaderTimestamp = "X-TBB-Timestamp"
+const HeaderSignature = "X-TBB-Signature"
+
+// HeaderNonce is unique to each signed request, a node accepts it once within MaxSignatureAge
+const HeaderNonce = "X-TBB-Nonce"
+
+// MaxSignatureAge bounds how old, or how far in the future, a signed request can be
+const MaxSignatureAge = 5 * time.Minute
+
+// WithToken authenticates every request with the given API token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHMACSecret signs every request with the given shared secret
+func WithHMACSecret(secret []byte) Option {
+	return func(c *Client) {
+		c.hmacSecret = secret
+	}
+}
+
+// SignRequest adds the timestamp, nonce and signature headers to req, body being the exact request body
+func SignRequest(req *http.Request, body []byte, secret []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, signature(req, body, secret, timestamp))
+}
+
+// VerifySignature checks the signature headers of req, body being the exact request body.
+// Telling replayed requests apart is left to the caller, from the nonce header
+func VerifySignature(req *http.Request, body []byte, secret []byte, now time.Time) error {
+	timestamp := req.Header.Get(HeaderTimestamp)
+	sig := req.Header.Get(HeaderSignature)
+	if timestamp == "" || sig == "" || req.Header.Get(HeaderNonce) == "" {
+		return fmt.Errorf("missing %s, %s or %s header", HeaderTimestamp, HeaderNonce, HeaderSignature)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header", HeaderTimestamp)
+	}
+
+	age := now.Sub(time.Unix(unix, 0))
+	if age > MaxSignatureAge || age < -MaxSignatureAge {
+		return fmt.Errorf("signature timestamp is outside of the accepted %s window", MaxSignatureAge)
+	}
+
+	expected := signature(req, body, secret, timestamp)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// signature is the hex encoded HMAC-SHA256 of the method, path with query, timestamp, nonce and body hash
+func signature(req *http.Request, body []byte, secret []byte, timestamp string) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp, req.Header.Get(HeaderNonce), hex.EncodeToString(bodyHash[:]))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+const EndpointBalancesListQueryKeySort = "sort"
+const EndpointBalancesListQueryKeyOrder = "order"
+const EndpointBalancesListQueryKeyLimit = "limit"
+const EndpointBalancesListQueryKeyCursor = "cursor"
+const EndpointBalancesListQueryKeyMinBalance = "min_balance"
+const EndpointBalancesListQueryKeyAccounts = "accounts"
+
+const OrderAsc = "asc"
+const OrderDesc = "desc"
+
+// ListBalances queries a page of the balances, sorted and filtered by q
+func (c *Client) ListBalances(ctx context.Context, q database.BalancesQuery) (BalancesRes, error) {
+	res := BalancesRes{}
+	err := c.do(ctx, http.MethodGet, EndpointBalancesList, BalancesQueryValues(q), nil, &res, true)
+
+	return res, err
+}
+
+// BalancesQueryValues encodes q as the query string of EndpointBalancesList
+func BalancesQueryValues(q database.BalancesQuery) url.Values {
+	query := url.Values{}
+
+	if q.SortBy != "" {
+		query.Set(EndpointBalancesListQueryKeySort, q.SortBy)
+	}
+	if q.Desc {
+		query.Set(EndpointBalancesListQueryKeyOrder, OrderDesc)
+	}
+	if q.Limit > 0 {
+		query.Set(EndpointBalancesListQueryKeyLimit, strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		query.Set(EndpointBalancesListQueryKeyCursor, q.Cursor)
+	}
+	if q.MinBalance > 0 {
+		query.Set(EndpointBalancesListQueryKeyMinBalance, strconv.FormatUint(uint64(q.MinBalance), 10))
+	}
+	if len(q.Accounts) > 0 {
+		accounts := make([]string, len(q.Accounts))
+		for i, account := range q.Accounts {
+			accounts[i] = string(account)
+		}
+
+		query.Set(EndpointBalancesListQueryKeyAccounts, strings.Join(accounts, ","))
+	}
+
+	return query
+}
+
+// ParseBalancesQuery reads the query string of EndpointBalancesList.
+// Accounts are comma separated, and the key can be repeated
+func ParseBalancesQuery(query url.Values) (database.BalancesQuery, error) {
+	q := database.BalancesQuery{
+		SortBy: query.Get(EndpointBalancesListQueryKeySort),
+		Cursor: query.Get(EndpointBalancesListQueryKeyCursor),
+	}
+
+	switch order := query.Get(EndpointBalancesListQueryKeyOrder); order {
+	case "", OrderAsc:
+	case OrderDesc:
+		q.Desc = true
+	default:
+		return database.BalancesQuery{}, fmt.Errorf("invalid order '%s', expected '%s' or '%s'", order, OrderAsc, OrderDesc)
+	}
+
+	if raw := query.Get(EndpointBalancesListQueryKeyLimit); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return database.BalancesQuery{}, fmt.Errorf("invalid limit '%s'", raw)
+		}
+
+		q.Limit = limit
+	}
+
+	if raw := query.Get(EndpointBalancesListQueryKeyMinBalance); raw != "" {
+		minBalance, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return database.BalancesQuery{}, fmt.Errorf("invalid minimum balance '%s'", raw)
+		}
+
+		q.MinBalance = uint(minBalance)
+	}
+
+	for _, raw := range query[EndpointBalancesListQueryKeyAccounts] {
+		for _, account := range strings.Split(raw, ",") {
+			if account = strings.TrimSpace(account); account != "" {
+				q.Accounts = append(q.Accounts, database.NewAccount(account))
+			}
+		}
+	}
+
+	return q, nil
+}
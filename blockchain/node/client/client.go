@@ -0,0 +1,409 @@
+// Package client is a typed Go client for the HTTP API of a TBB node
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+const DefaultTimeout = 10 * time.Second
+const DefaultRetries = 2
+const DefaultRetryWait = 250 * time.Millisecond
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    int
+	retryWait  time.Duration
+
+	token      string
+	hmacSecret []byte
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient makes the client send its requests through hc, to share connections between clients
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithTimeout bounds every single attempt of a request
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries sets how many times an idempotent request is retried after a temporary failure,
+// waiting wait, then twice as long, between attempts
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// New creates a client for the node listening on addr, either "ip:port" or a full base URL
+func New(addr string, opts ...Option) *Client {
+	baseURL := addr
+	if !strings.Contains(addr, "://") {
+		baseURL = fmt.Sprintf("http://%s", addr)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    DefaultTimeout,
+		retries:    DefaultRetries,
+		retryWait:  DefaultRetryWait,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+func (c *Client) Status(ctx context.Context) (StatusRes, error) {
+	res := StatusRes{}
+	err := c.do(ctx, http.MethodGet, EndpointStatus, nil, nil, &res, true)
+
+	return res, err
+}
+
+// Sync fetches the blocks the node stores after fromBlock. The node caps how many blocks it sends at once,
+// res.More telling whether to call Sync again from the last returned block.
+//
+// Deprecated: use Headers then Blocks, which let the caller verify the chain before downloading it
+func (c *Client) Sync(ctx context.Context, fromBlock database.Hash) (SyncRes, error) {
+	query := url.Values{}
+	query.Set(EndpointSyncQueryKeyFromBlock, fromBlock.Hex())
+
+	res := SyncRes{}
+	err := c.do(ctx, http.MethodGet, EndpointSync, query, nil, &res, true)
+
+	return res, err
+}
+
+// Headers fetches at most limit headers of the blocks the node stores after fromBlock, or from its first block
+// when fromBlock is empty. The node may send fewer, res.More telling whether more follow. A node which doesn't
+// store fromBlock answers 404
+func (c *Client) Headers(ctx context.Context, fromBlock database.Hash, limit int) (HeadersRes, error) {
+	query := url.Values{}
+	query.Set(EndpointHeadersQueryKeyFromBlock, fromBlock.Hex())
+	query.Set(EndpointSyncQueryKeyLimit, strconv.Itoa(limit))
+
+	res := HeadersRes{}
+	err := c.do(ctx, http.MethodGet, EndpointHeaders, query, nil, &res, true)
+
+	return res, err
+}
+
+// Blocks fetches at most limit blocks starting with the block numbered fromNumber. The node may send fewer
+func (c *Client) Blocks(ctx context.Context, fromNumber uint64, limit int) (BlocksRes, error) {
+	query := url.Values{}
+	query.Set(EndpointBlocksQueryKeyFromNumber, strconv.FormatUint(fromNumber, 10))
+	query.Set(EndpointSyncQueryKeyLimit, strconv.Itoa(limit))
+
+	res := BlocksRes{}
+	err := c.do(ctx, http.MethodGet, EndpointBlocks, query, nil, &res, true)
+
+	return res, err
+}
+
+// SyncNow asks the node to sync with its peers right away, and waits for the round to complete.
+// A round can take longer than DefaultTimeout, see WithTimeout
+func (c *Client) SyncNow(ctx context.Context) (SyncNowRes, error) {
+	res := SyncNowRes{}
+	err := c.do(ctx, http.MethodPost, EndpointSyncNow, nil, nil, &res, false)
+
+	return res, err
+}
+
+// Handshake joins the node, telling it about self. It returns a HandshakeError when the node rejects self,
+// or answers the handshake without accepting it
+func (c *Client) Handshake(ctx context.Context, self NodeInfo) (HandshakeRes, error) {
+	res := HandshakeRes{}
+	err := c.do(ctx, http.MethodPost, EndpointHandshake, nil, self, &res, true)
+	if err != nil {
+		return res, err
+	}
+
+	if !res.Accepted {
+		return res, &HandshakeError{Peer: c.baseURL, Reason: res.Error}
+	}
+
+	return res, nil
+}
+
+// AddPeer asks the node to add ip:port into its known peers.
+//
+// Deprecated: nodes now join each other with Handshake, AddPeer is always refused
+func (c *Client) AddPeer(ctx context.Context, ip string, port uint64) (AddPeerRes, error) {
+	query := url.Values{}
+	query.Set(EndpointAddPeerQueryKeyIP, ip)
+	query.Set(EndpointAddPeerQueryKeyPort, strconv.FormatUint(port, 10))
+
+	res := AddPeerRes{}
+	err := c.do(ctx, http.MethodGet, EndpointAddPeer, query, nil, &res, true)
+	if err != nil {
+		return res, err
+	}
+
+	if res.Error != "" {
+		return res, &APIError{Endpoint: EndpointAddPeer, StatusCode: http.StatusOK, Message: res.Error}
+	}
+
+	return res, nil
+}
+
+func (c *Client) Balances(ctx context.Context) (BalancesRes, error) {
+	return c.ListBalances(ctx, database.BalancesQuery{})
+}
+
+// AddTx submits a new transaction and commits it in a block along with the pending ones, see EndpointTxAdd.
+// It is never retried as the node may have already committed it
+func (c *Client) AddTx(ctx context.Context, req TxAddReq) (TxAddRes, error) {
+	res := TxAddRes{}
+	err := c.do(ctx, http.MethodPost, EndpointTxAdd, nil, req, &res, false)
+
+	return res, err
+}
+
+// AddTxBatch submits txs to be committed together in a single block, or not at all.
+// When the batch is rejected the error is an *APIError and res still holds the error of each tx
+func (c *Client) AddTxBatch(ctx context.Context, txs []TxAddReq) (TxBatchRes, error) {
+	res := TxBatchRes{}
+	err := c.do(ctx, http.MethodPost, EndpointTxBatch, nil, TxBatchReq{Txs: txs}, &res, false)
+
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusUnprocessableEntity {
+		json.Unmarshal(apiErr.Body, &res)
+	}
+
+	return res, err
+}
+
+// SimulateTxs dry-runs txs against the node's current state, as /tx/batch would commit them
+func (c *Client) SimulateTxs(ctx context.Context, txs []TxAddReq) (TxSimulateRes, error) {
+	res := TxSimulateRes{}
+	err := c.do(ctx, http.MethodPost, EndpointTxSimulate, nil, TxBatchReq{Txs: txs}, &res, true)
+
+	return res, err
+}
+
+// Peers lists the peers known by the node with their score and ban status
+func (c *Client) Peers(ctx context.Context) (PeersRes, error) {
+	res := PeersRes{}
+	err := c.do(ctx, http.MethodGet, EndpointPeers, nil, nil, &res, true)
+
+	return res, err
+}
+
+// AnnounceBlock pushes a newly committed block to the node. It isn't retried, the node syncs it anyway
+func (c *Client) AnnounceBlock(ctx context.Context, req BlockAnnounceReq) (AnnounceRes, error) {
+	res := AnnounceRes{}
+	err := c.do(ctx, http.MethodPost, EndpointBlock, nil, req, &res, false)
+
+	return res, err
+}
+
+// AddPendingTx adds a transaction to the mempool of the node, which gossips it to the network.
+// It is committed once a node commits its mempool
+func (c *Client) AddPendingTx(ctx context.Context, req TxAddReq) (MempoolAddRes, error) {
+	res := MempoolAddRes{}
+	err := c.do(ctx, http.MethodPost, EndpointMempoolAdd, nil, req, &res, false)
+
+	return res, err
+}
+
+// Mempool lists the transactions pending on the node
+func (c *Client) Mempool(ctx context.Context) (MempoolRes, error) {
+	res := MempoolRes{}
+	err := c.do(ctx, http.MethodGet, EndpointMempoolList, nil, nil, &res, true)
+
+	return res, err
+}
+
+// CommitMempool makes the node commit its pending transactions in a new block
+func (c *Client) CommitMempool(ctx context.Context) (MempoolCommitRes, error) {
+	res := MempoolCommitRes{}
+	err := c.do(ctx, http.MethodPost, EndpointMempoolCommit, nil, nil, &res, false)
+
+	return res, err
+}
+
+// AnnounceTx gossips a pending transaction to the node
+func (c *Client) AnnounceTx(ctx context.Context, req TxAnnounceReq) (AnnounceRes, error) {
+	res := AnnounceRes{}
+	err := c.do(ctx, http.MethodPost, EndpointTx, nil, req, &res, false)
+
+	return res, err
+}
+
+// Call invokes a single method of the JSON-RPC 2.0 interface and decodes its result into result
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	req := RPCReq{
+		JSONRPC: "2.0",
+		Method:  method,
+		ID:      json.RawMessage("1"),
+	}
+
+	if params != nil {
+		paramsJson, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = paramsJson
+	}
+
+	res := struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}{}
+
+	err := c.do(ctx, http.MethodPost, EndpointRPC, nil, req, &res, false)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if result == nil || len(res.Result) == 0 {
+		return nil
+	}
+
+	err = json.Unmarshal(res.Result, result)
+	if err != nil {
+		return &DecodeError{Endpoint: EndpointRPC, Err: err}
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, reqBody interface{}, resBody interface{}, idempotent bool) error {
+	var reqBodyJson []byte
+	if reqBody != nil {
+		var err error
+		reqBodyJson, err = json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+	}
+
+	retries := c.retries
+	if !idempotent {
+		retries = 0
+	}
+
+	wait := c.retryWait
+	var err error
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(wait):
+				wait *= 2
+			case <-ctx.Done():
+				return &ConnError{Endpoint: path, Err: ctx.Err()}
+			}
+		}
+
+		err = c.doOnce(ctx, method, path, query, reqBodyJson, resBody)
+		if err == nil || !isTemporary(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (c *Client) doOnce(ctx context.Context, method string, path string, query url.Values, reqBodyJson []byte, resBody interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	reqURL := c.baseURL + path
+	if len(query) > 0 {
+		reqURL = fmt.Sprintf("%s?%s", reqURL, query.Encode())
+	}
+
+	var body io.Reader
+	if reqBodyJson != nil {
+		body = bytes.NewReader(reqBodyJson)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+
+	if reqBodyJson != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.token != "" {
+		req.Header.Set(HeaderAuthorization, "Bearer "+c.token)
+	}
+
+	if c.hmacSecret != nil {
+		SignRequest(req, reqBodyJson, c.hmacSecret, time.Now())
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return &ConnError{Endpoint: path, Err: err}
+	}
+	defer res.Body.Close()
+
+	resBodyJson, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return &ConnError{Endpoint: path, Err: err}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		errRes := ErrRes{}
+		if json.Unmarshal(resBodyJson, &errRes) != nil || errRes.Error == "" {
+			errRes.Error = strings.TrimSpace(string(resBodyJson))
+		}
+
+		return &APIError{Endpoint: path, StatusCode: res.StatusCode, Message: errRes.Error, Body: resBodyJson}
+	}
+
+	err = json.Unmarshal(resBodyJson, resBody)
+	if err != nil {
+		return &DecodeError{Endpoint: path, Err: err}
+	}
+
+	return nil
+}
+
+func isTemporary(err error) bool {
+	switch e := err.(type) {
+	case *ConnError:
+		return true
+	case *APIError:
+		return e.Temporary()
+	}
+
+	return false
+}
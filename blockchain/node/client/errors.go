@@ -0,0 +1,68 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned when the node answered a request with an error response
+type APIError struct {
+	Endpoint   string
+	StatusCode int
+	Message    string
+
+	// Body is the raw response, for endpoints answering errors with more than a message
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s responded %d: %s", e.Endpoint, e.StatusCode, e.Message)
+}
+
+// Temporary reports whether repeating the request may succeed
+func (e *APIError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
+
+// ConnError is returned when the node could not be reached or the request timed out
+type ConnError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *ConnError) Error() string {
+	return fmt.Sprintf("unable to reach %s. %s", e.Endpoint, e.Err.Error())
+}
+
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// HandshakeError is returned when a node rejected the handshake of another, or the other way around
+type HandshakeError struct {
+	Peer   string
+	Reason string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("handshake with %s rejected: %s", e.Peer, e.Reason)
+}
+
+// DecodeError is returned when the node answered with a body that isn't the expected response
+type DecodeError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("malformed response from %s. %s", e.Endpoint, e.Err.Error())
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
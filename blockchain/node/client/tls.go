@@ -0,0 +1,73 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// CertFingerprint is the hex encoded SHA-256 of a DER encoded certificate, as used to pin it
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTLSConfig creates the TLS configuration to reach nodes serving certificates that aren't publicly trusted.
+// caFile is a PEM bundle of private CAs to trust. pins are CertFingerprint of accepted leaf certificates:
+// when given, the node must present one of them, and without a caFile the chain itself isn't verified
+func NewTLSConfig(caFile string, pins []string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		caPem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no certificate found in '%s'", caFile)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if len(pins) == 0 {
+		return cfg, nil
+	}
+
+	pinned := make(map[string]bool)
+	for _, pin := range pins {
+		pin = strings.ToLower(strings.Replace(pin, ":", "", -1))
+		if _, err := hex.DecodeString(pin); err != nil || len(pin) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid certificate fingerprint '%s', expected a hex encoded SHA-256", pin)
+		}
+
+		pinned[pin] = true
+	}
+
+	// self-signed certificates of local networks can't be chained to a CA, the pin is what authenticates them
+	if caFile == "" {
+		cfg.InsecureSkipVerify = true
+	}
+
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no certificate presented")
+		}
+
+		fingerprint := CertFingerprint(rawCerts[0])
+		if !pinned[fingerprint] {
+			return fmt.Errorf("certificate %s is not pinned", fingerprint)
+		}
+
+		return nil
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// HTTP API of a TBB node
+const EndpointBalancesList = "/balances/list"
+
+// EndpointTxAdd adds the transaction to the mempool, gossiped as EndpointMempoolAdd does, and commits the
+// mempool right away, answering the hash of the block committing the transaction
+const EndpointTxAdd = "/tx/add"
+const EndpointTxBatch = "/tx/batch"
+const EndpointTxSimulate = "/tx/simulate"
+
+// The mempool holds transactions pending until a node commits them in a block
+const EndpointMempoolAdd = "/mempool/add"
+const EndpointMempoolList = "/mempool/list"
+const EndpointMempoolCommit = "/mempool/commit"
+
+const EndpointStatus = "/node/status"
+
+// Deprecated: EndpointSync is only served to nodes which don't know EndpointHeaders and EndpointBlocks yet
+const EndpointSync = "/node/sync"
+const EndpointSyncQueryKeyFromBlock = "fromBlock"
+
+// Nodes sync headers first, then the blocks of the headers which chain together
+const EndpointHeaders = "/node/headers"
+const EndpointHeadersQueryKeyFromBlock = "fromBlock"
+const EndpointBlocks = "/node/blocks"
+const EndpointBlocksQueryKeyFromNumber = "fromNumber"
+const EndpointSyncQueryKeyLimit = "limit"
+
+// Runs a sync round right away
+const EndpointSyncNow = "/node/sync-now"
+
+const EndpointPeers = "/node/peers"
+const EndpointBlock = "/node/block"
+const EndpointTx = "/node/tx"
+
+// Nodes join each other with a handshake telling who they are and which protocol they speak
+const EndpointHandshake = "/node/handshake"
+
+// Deprecated: EndpointAddPeer is only answered to tell nodes which don't know EndpointHandshake to upgrade
+const EndpointAddPeer = "/node/peer"
+const EndpointAddPeerQueryKeyIP = "ip"
+const EndpointAddPeerQueryKeyPort = "port"
+
+const EndpointRPC = "/rpc"
+
+type ErrRes struct {
+	Error string `json:"error"`
+}
+
+type SyncRes struct {
+	Blocks []database.Block `json:"blocks"`
+
+	// More is set when the node capped the response and more blocks follow the last one
+	More bool `json:"more"`
+}
+
+type HeadersRes struct {
+	Headers []database.HeaderFS `json:"headers"`
+
+	// More is set when more blocks follow the last returned header
+	More bool `json:"more"`
+}
+
+type BlocksRes struct {
+	Blocks []database.BlockFS `json:"blocks"`
+
+	// More is set when more blocks follow the last returned one
+	More bool `json:"more"`
+}
+
+type SyncNowRes struct {
+	Hash   database.Hash `json:"block_hash"`
+	Number uint64        `json:"block_number"`
+
+	BlocksImported  int    `json:"blocks_imported"`
+	PeersDiscovered int    `json:"peers_discovered"`
+	Duration        string `json:"duration"`
+
+	Peers []PeerSyncRes `json:"peers"`
+}
+
+// PeerSyncRes tells how syncing with a single peer went
+type PeerSyncRes struct {
+	Peer   string `json:"peer"`
+	Number uint64 `json:"block_number"`
+
+	BlocksImported  int `json:"blocks_imported"`
+	PeersDiscovered int `json:"peers_discovered"`
+
+	// Skipped tells why the peer wasn't synced with, Error why syncing with it failed
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type BalancesRes struct {
+	Hash     database.Hash             `json:"block_hash"`
+	Balances map[database.Account]uint `json:"balances"`
+
+	// Accounts holds the same balances as Balances, in the requested order
+	Accounts     []database.AccountBalance `json:"accounts"`
+	NextCursor   string                    `json:"next_cursor,omitempty"`
+	Matched      int                       `json:"matched"`
+	AccountCount int                       `json:"account_count"`
+	TotalSupply  uint                      `json:"total_supply"`
+}
+
+type TxAddReq struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Value uint   `json:"value"`
+	Data  string `json:"data"`
+}
+
+type TxAddRes struct {
+	Hash database.Hash `json:"block_hash"`
+}
+
+type MempoolAddRes struct {
+	Hash database.Hash `json:"tx_hash"`
+}
+
+type PendingTx struct {
+	Hash database.Hash `json:"tx_hash"`
+	Tx   database.Tx   `json:"tx"`
+}
+
+type MempoolRes struct {
+	Txs []PendingTx `json:"txs"`
+}
+
+type MempoolCommitRes struct {
+	Hash database.Hash `json:"block_hash"`
+	Txs  int           `json:"txs"`
+}
+
+type TxBatchReq struct {
+	Txs []TxAddReq `json:"txs"`
+}
+
+// TxBatchRes tells whether the whole batch was committed in the block Hash, and the outcome of each tx
+type TxBatchRes struct {
+	Accepted bool          `json:"accepted"`
+	Hash     database.Hash `json:"block_hash"`
+	Results  []TxResult    `json:"results"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// TxSimulateRes tells whether the txs would be accepted together, and the balance changes they would make
+type TxSimulateRes struct {
+	Valid   bool                       `json:"valid"`
+	Deltas  map[database.Account]int64 `json:"deltas,omitempty"`
+	Results []TxResult                 `json:"results"`
+	Error   string                     `json:"error,omitempty"`
+}
+
+type TxResult struct {
+	Index int           `json:"index"`
+	Hash  database.Hash `json:"tx_hash"`
+	Error string        `json:"error,omitempty"`
+}
+
+type StatusRes struct {
+	Hash       database.Hash   `json:"block_hash"`
+	Number     uint64          `json:"block_number"`
+	KnownPeers map[string]Peer `json:"peers_known"`
+}
+
+// BlockAnnounceReq pushes a block committed by the node at From, given as ip:port
+type BlockAnnounceReq struct {
+	From  string           `json:"from"`
+	Block database.BlockFS `json:"block"`
+}
+
+// TxAnnounceReq gossips a transaction added to the mempool of the node at From, given as ip:port
+type TxAnnounceReq struct {
+	From string      `json:"from"`
+	Tx   database.Tx `json:"tx"`
+}
+
+// AnnounceRes tells whether the announced block or transaction was accepted, or was already known
+type AnnounceRes struct {
+	Accepted bool   `json:"accepted"`
+	Known    bool   `json:"known"`
+	Error    string `json:"error,omitempty"`
+}
+
+// PeerInfo is a known peer along with how syncing with it went
+type PeerInfo struct {
+	Peer
+	Connected bool `json:"connected"`
+
+	// Latest block number the peer reported
+	Number uint64 `json:"block_number"`
+
+	// Negotiated during the handshake, empty until the node joined the peer or the peer joined it
+	NodeID          string   `json:"node_id,omitempty"`
+	ProtocolVersion uint     `json:"protocol_version,omitempty"`
+	Features        []string `json:"features,omitempty"`
+	TCPPort         uint64   `json:"tcp_port,omitempty"`
+
+	Score     int    `json:"score"`
+	Successes uint64 `json:"successes"`
+	Failures  uint64 `json:"failures"`
+	Bans      uint64 `json:"bans"`
+
+	// Unix times, 0 when the peer was never seen, isn't banned or isn't backed off
+	LastSeen    uint64 `json:"last_seen"`
+	Banned      bool   `json:"banned"`
+	BannedUntil uint64 `json:"banned_until,omitempty"`
+	RetryAt     uint64 `json:"retry_at,omitempty"`
+}
+
+type PeersRes struct {
+	Peers []PeerInfo `json:"peers"`
+}
+
+// NodeInfo is what a node tells about itself during the handshake
+type NodeInfo struct {
+	ProtocolVersion uint   `json:"protocol_version"`
+	NodeID          string `json:"node_id"`
+
+	// Nodes only join the nodes of the same chain
+	ChainID     string        `json:"chain_id"`
+	GenesisHash database.Hash `json:"genesis_hash"`
+
+	// Address the node is reached at
+	IP   string `json:"ip"`
+	Port uint64 `json:"port"`
+
+	// Port of the TCP transport, 0 when the node only speaks HTTP
+	TCPPort uint64 `json:"tcp_port,omitempty"`
+
+	Hash     database.Hash `json:"block_hash"`
+	Number   uint64        `json:"block_number"`
+	Features []string      `json:"features"`
+}
+
+type HandshakeRes struct {
+	Accepted bool `json:"accepted"`
+
+	// Error tells why the node was rejected
+	Error string `json:"error,omitempty"`
+
+	// Node is the node answering the handshake
+	Node NodeInfo `json:"node"`
+}
+
+type AddPeerRes struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// Peer is a node as advertised by another node in its StatusRes
+type Peer struct {
+	IP          string `json:"ip"`
+	Port        uint64 `json:"port"`
+	IsBootstrap bool   `json:"is_bootstrap"`
+}
+
+func (p Peer) TcpAddress() string {
+	return net.JoinHostPort(p.IP, strconv.FormatUint(p.Port, 10))
+}
+
+type RPCReq struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type RPCRes struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
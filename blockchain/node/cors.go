@@ -0,0 +1,85 @@
+package node
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+const corsMaxAge = 600
+
+// corsAllowedHeaders are the request headers a browser client may send, credentials included
+var corsAllowedHeaders = []string{
+	"Content-Type",
+	client.HeaderAuthorization,
+	client.HeaderTimestamp,
+	client.HeaderNonce,
+	client.HeaderSignature,
+}
+
+type CORSConfig struct {
+	// Origins of the browser clients allowed to call the API, e.g. "https://wallet.example.com", or "*" for any
+	AllowedOrigins []string
+}
+
+func (c CORSConfig) Enabled() bool {
+	return len(c.AllowedOrigins) > 0
+}
+
+func (c CORSConfig) allows(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithCORS lets browser clients served from other origins call the API
+func WithCORS(cfg CORSConfig) Option {
+	return func(n *Node) {
+		n.cors = cfg
+	}
+}
+
+// allowCORS answers preflight requests and marks the responses to allowed origins as readable by them.
+// Preflights are answered before the rate limit and auth checks, as browsers send them without credentials
+func (n *Node) allowCORS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !n.cors.Enabled() {
+			handler(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		allowed := n.cors.allows(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			handler(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodOptions}, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,213 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// UDP port the nodes of a LAN announce themselves on
+const DefaultDiscoveryPort = uint64(8070)
+
+// Announcements are broadcast to the whole subnet unless a subnet broadcast address or a multicast group is given
+const DefaultDiscoveryAddr = "255.255.255.255"
+
+const DefaultDiscoveryInterval = 30 * time.Second
+
+// A node announces itself at most this often when new nodes keep showing up
+const discoveryMinGap = time.Second
+
+// Announcements are tiny, larger datagrams aren't ours
+const discoveryMaxDatagram = 2048
+
+type DiscoveryConfig struct {
+	// UDP port every node of the LAN listens and announces on
+	Port uint64
+
+	// Where the announcements are sent: a broadcast address, e.g. 192.168.1.255, or 127.255.255.255 to discover
+	// the nodes running on this host, or a multicast group, e.g. 239.255.42.99
+	Addr string
+
+	// Time between two announcements
+	Interval time.Duration
+}
+
+func DefaultDiscoveryConfig() DiscoveryConfig {
+	return DiscoveryConfig{
+		Port:     DefaultDiscoveryPort,
+		Addr:     DefaultDiscoveryAddr,
+		Interval: DefaultDiscoveryInterval,
+	}
+}
+
+// WithDiscovery announces the node on the local network and adds the nodes of the same chain announcing
+// themselves into its known peers, so they join each other on the next sync round. Zero fields of cfg keep their default
+func WithDiscovery(cfg DiscoveryConfig) Option {
+	return func(n *Node) {
+		defaults := DefaultDiscoveryConfig()
+
+		if cfg.Port == 0 {
+			cfg.Port = defaults.Port
+		}
+		if cfg.Addr == "" {
+			cfg.Addr = defaults.Addr
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = defaults.Interval
+		}
+
+		n.discovery = cfg
+		n.discoveryEnabled = true
+	}
+}
+
+// discoveryAnnouncement is the datagram a node sends to tell the LAN where its API is
+type discoveryAnnouncement struct {
+	ProtocolVersion uint          `json:"protocol_version"`
+	NodeID          string        `json:"node_id"`
+	ChainID         string        `json:"chain_id"`
+	GenesisHash     database.Hash `json:"genesis_hash"`
+	IP              string        `json:"ip"`
+	Port            uint64        `json:"port"`
+}
+
+// listenDiscovery opens the socket announcements are sent and received on. Several nodes of the same host
+// share the port, see reuseAddr
+func (n *Node) listenDiscovery() (*net.UDPConn, error) {
+	group := net.ParseIP(n.discovery.Addr)
+	if group == nil {
+		return nil, fmt.Errorf("invalid discovery address '%s', expected a broadcast or multicast IPv4 address", n.discovery.Addr)
+	}
+
+	if group.IsMulticast() {
+		return net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: group, Port: int(n.discovery.Port)})
+	}
+
+	lc := net.ListenConfig{Control: reuseAddr}
+	conn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", n.discovery.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*net.UDPConn), nil
+}
+
+// discover announces the node every interval, and early when a new node shows up so it learns about this one
+// right away, until ctx is done
+func (n *Node) discover(ctx context.Context, conn *net.UDPConn) {
+	dst := &net.UDPAddr{IP: net.ParseIP(n.discovery.Addr), Port: int(n.discovery.Port)}
+
+	discovered := make(chan struct{}, 1)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go n.receiveAnnouncements(conn, discovered)
+
+	ticker := time.NewTicker(n.discovery.Interval)
+	defer ticker.Stop()
+
+	var early <-chan time.Time
+	lastAnnounce := time.Time{}
+
+	for {
+		if early == nil {
+			n.sendAnnouncement(conn, dst)
+			lastAnnounce = time.Now()
+		}
+
+		select {
+		case <-ticker.C:
+			early = nil
+
+		case <-discovered:
+			if early == nil {
+				early = time.After(discoveryMinGap - time.Since(lastAnnounce))
+			}
+			continue
+
+		case <-early:
+			early = nil
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Node) sendAnnouncement(conn *net.UDPConn, dst *net.UDPAddr) {
+	announcement, err := json.Marshal(discoveryAnnouncement{
+		ProtocolVersion: ProtocolVersion,
+		NodeID:          n.id,
+		ChainID:         n.state.ChainID(),
+		GenesisHash:     n.state.GenesisHash(),
+		IP:              n.ip,
+		Port:            n.port,
+	})
+	if err != nil {
+		return
+	}
+
+	_, err = conn.WriteToUDP(announcement, dst)
+	if err != nil {
+		fmt.Printf("ERROR: unable to announce the node to %s. %s\n", dst, err)
+	}
+}
+
+// receiveAnnouncements adds the announcing nodes of the same chain into the known peers, and signals discovered
+// for each new one. It returns once conn is closed
+func (n *Node) receiveAnnouncements(conn *net.UDPConn, discovered chan<- struct{}) {
+	buf := make([]byte, discoveryMaxDatagram)
+
+	for {
+		read, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		announcement := discoveryAnnouncement{}
+		if json.Unmarshal(buf[:read], &announcement) != nil {
+			continue
+		}
+
+		peer, ok := n.discoveredPeer(announcement, from)
+		if !ok || n.IsKnownPeer(peer) || n.isBannedPeer(peer.TcpAddress()) {
+			continue
+		}
+
+		n.AddPeer(peer)
+
+		fmt.Printf("Discovered Peer '%s' on the local network\n", peer.TcpAddress())
+
+		select {
+		case discovered <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// discoveredPeer is the peer announced, unless it is this node or another chain
+func (n *Node) discoveredPeer(announcement discoveryAnnouncement, from *net.UDPAddr) (PeerNode, bool) {
+	if announcement.NodeID == "" || announcement.NodeID == n.id || announcement.Port == 0 {
+		return PeerNode{}, false
+	}
+
+	if announcement.ProtocolVersion < MinProtocolVersion || announcement.ChainID != n.state.ChainID() || announcement.GenesisHash != n.state.GenesisHash() {
+		return PeerNode{}, false
+	}
+
+	// a node left with the default IP announces a loopback address, which only works for the nodes of its host
+	ip := announcement.IP
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsUnspecified() || (parsed.IsLoopback() && !from.IP.IsLoopback()) {
+		ip = from.IP.String()
+	}
+
+	return NewPeerNode(ip, announcement.Port, false, false), true
+}
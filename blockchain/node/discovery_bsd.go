@@ -0,0 +1,25 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package node
+
+import (
+	"syscall"
+)
+
+// reuseAddr lets the nodes of a host bind the same discovery port, each receiving every broadcast announcement.
+// BSD kernels only share the port of sockets which all set SO_REUSEPORT
+func reuseAddr(network string, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		if sockErr == nil {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
@@ -0,0 +1,19 @@
+package node
+
+import (
+	"syscall"
+)
+
+// reuseAddr lets the nodes of a host bind the same discovery port, each receiving every broadcast announcement.
+// Linux shares the port of UDP sockets which all set SO_REUSEADDR
+func reuseAddr(network string, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sockErr
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package node
+
+import (
+	"syscall"
+)
+
+// reuseAddr leaves the socket as is, so only one node of the host can bind the discovery port
+func reuseAddr(network string, address string, c syscall.RawConn) error {
+	return nil
+}
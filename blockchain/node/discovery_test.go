@@ -0,0 +1,71 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// freeUDPPort is a UDP port nothing listens on at the time of the call
+func freeUDPPort(t *testing.T) uint64 {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return uint64(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestDiscoveryOnLoopbackBroadcast(t *testing.T) {
+	cfg := DiscoveryConfig{
+		Port:     freeUDPPort(t),
+		Addr:     "127.255.255.255",
+		Interval: 100 * time.Millisecond,
+	}
+
+	nodes := make([]*Node, 3)
+	for i := range nodes {
+		n := New(newTestDataDir(t), WithPort(0), WithLimits(Limits{}), WithDiscovery(cfg))
+
+		err := n.Start(context.Background())
+		if err != nil {
+			t.Skipf("unable to start a node with LAN discovery on this host. %s", err)
+		}
+
+		t.Cleanup(func() {
+			err := n.Stop()
+			if err != nil {
+				t.Errorf("unable to stop the node. %s", err)
+			}
+		})
+
+		nodes[i] = n
+	}
+
+	// every node ends up knowing the two others
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		missing := 0
+		for _, n := range nodes {
+			for _, other := range nodes {
+				if other != n && !n.IsKnownPeer(testPeer(t, other)) {
+					missing++
+				}
+			}
+		}
+
+		if missing == 0 {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d nodes are still undiscovered", missing)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
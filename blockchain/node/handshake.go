@@ -0,0 +1,221 @@
+package node
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+// Version of the protocol spoken between nodes, raised on every change older nodes can't follow.
+// Version 2 introduced the handshake and the headers first sync
+const ProtocolVersion = uint(2)
+
+// Oldest protocol version a node still joins
+const MinProtocolVersion = uint(2)
+
+// Optional parts of the protocol, a node only uses the ones its peer supports too
+const FeatureHeadersSync = "headers-sync"
+const FeatureBlockPush = "block-push"
+const FeatureTxGossip = "tx-gossip"
+
+// FeatureTCP is only advertised by the nodes serving the TCP transport, see WithTCP
+const FeatureTCP = "tcp"
+
+var supportedFeatures = []string{FeatureHeadersSync, FeatureBlockPush, FeatureTxGossip, FeatureTCP}
+
+const endpointHandshake = client.EndpointHandshake
+
+const nodeIDFileName = "node_id"
+
+type NodeInfo = client.NodeInfo
+type HandshakeRes = client.HandshakeRes
+
+func getNodeIDFilePath(dataDir string) string {
+	return filepath.Join(dataDir, nodeIDFileName)
+}
+
+// loadNodeID reads the ID of the node, generated the first time the node starts and kept across restarts
+func loadNodeID(dataDir string) (string, error) {
+	nodeID, err := ioutil.ReadFile(getNodeIDFilePath(dataDir))
+	if err == nil {
+		return strings.TrimSpace(string(nodeID)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	random := make([]byte, 16)
+	_, err = rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	id := hex.EncodeToString(random)
+
+	return id, ioutil.WriteFile(getNodeIDFilePath(dataDir), []byte(id+"\n"), 0600)
+}
+
+// nodeInfo is what the node tells about itself in a handshake
+func (n *Node) nodeInfo() NodeInfo {
+	snapshot := n.state.Snapshot()
+
+	return NodeInfo{
+		ProtocolVersion: ProtocolVersion,
+		NodeID:          n.id,
+		ChainID:         n.state.ChainID(),
+		GenesisHash:     n.state.GenesisHash(),
+		IP:              n.ip,
+		Port:            n.port,
+		Hash:            snapshot.LatestBlockHash,
+		Number:          snapshot.LatestBlock.Header.Number,
+		Features:        n.features(),
+		TCPPort:         n.tcpPort,
+	}
+}
+
+// features lists the features the node serves, every supported one but the TCP transport when it is off
+func (n *Node) features() []string {
+	if n.tcpEnabled {
+		return supportedFeatures
+	}
+
+	features := make([]string, 0, len(supportedFeatures))
+	for _, feature := range supportedFeatures {
+		if feature != FeatureTCP {
+			features = append(features, feature)
+		}
+	}
+
+	return features
+}
+
+// checkNodeInfo tells why the node can't join, or be joined by, the node described by info
+func (n *Node) checkNodeInfo(info NodeInfo) string {
+	switch {
+	case info.ProtocolVersion < MinProtocolVersion:
+		return fmt.Sprintf("protocol version %d is too old, versions %d to %d are supported", info.ProtocolVersion, MinProtocolVersion, ProtocolVersion)
+	case info.NodeID == "":
+		return "the node ID is missing"
+	case info.NodeID == n.id:
+		return "a node can't join itself"
+	case info.ChainID != n.state.ChainID():
+		return fmt.Sprintf("chain id '%s' differs from '%s'", info.ChainID, n.state.ChainID())
+	case info.GenesisHash != n.state.GenesisHash():
+		return fmt.Sprintf("genesis '%x' differs from '%x'", info.GenesisHash, n.state.GenesisHash())
+	}
+
+	return ""
+}
+
+// negotiate records on the peer what both nodes speak: the older protocol version and the common features.
+// The block number of info isn't recorded, the peer's height is only taken from its status during a sync
+func (n *Node) negotiate(peer PeerNode, info NodeInfo) {
+	version := info.ProtocolVersion
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	features := make([]string, 0)
+	for _, feature := range info.Features {
+		if supportsFeature(supportedFeatures, feature) {
+			features = append(features, feature)
+		}
+	}
+
+	n.updatePeer(peer, func(p *PeerNode) {
+		p.NodeID = info.NodeID
+		p.ProtocolVersion = version
+		p.Features = features
+		p.TCPPort = info.TCPPort
+		p.connected = true
+	})
+}
+
+// supports tells whether the peer negotiated the feature
+func (pn PeerNode) supports(feature string) bool {
+	return supportsFeature(pn.Features, feature)
+}
+
+func supportsFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handshakeHandler lets a node join this one, when both speak a common protocol version on the same chain
+func handshakeHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	info := NodeInfo{}
+	err := readReq(r, &info)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	reject := func(reason string) {
+		fmt.Printf("Rejected the handshake of '%s:%d'. %s\n", info.IP, info.Port, reason)
+
+		writeRes(w, HandshakeRes{
+			Accepted: false,
+			Error:    reason,
+			Node:     node.nodeInfo(),
+		})
+	}
+
+	if info.IP == "" || info.Port == 0 {
+		reject("the address of the node is missing")
+		return
+	}
+
+	// the node is only taken at its word for the ports, on the IP it connected from. A node left with a loopback
+	// or unspecified IP is reached on that IP instead
+	ip := clientIP(r)
+	announced := net.ParseIP(info.IP)
+	remote := net.ParseIP(ip)
+	if announced == nil || announced.IsUnspecified() || (announced.IsLoopback() && remote != nil && !remote.IsLoopback()) {
+		info.IP = ip
+	} else if !sameIP(info.IP, ip) {
+		reject(fmt.Sprintf("the node announces IP %s but connected from %s", info.IP, ip))
+		return
+	}
+
+	peer := NewPeerNode(info.IP, info.Port, false, true)
+	peer.authenticated = node.auth.Enabled() && isAuthenticated(r)
+
+	if node.isBannedPeer(peer.TcpAddress()) {
+		reject(fmt.Sprintf("peer '%s' is banned", peer.TcpAddress()))
+		return
+	}
+
+	reason := node.checkNodeInfo(info)
+	if reason != "" {
+		reject(reason)
+		return
+	}
+
+	node.AddPeer(peer)
+	node.negotiate(peer, info)
+
+	fmt.Printf("Peer '%s' was added into KnownPeers, speaking protocol version %d\n", peer.TcpAddress(), info.ProtocolVersion)
+
+	writeRes(w, HandshakeRes{
+		Accepted: true,
+		Node:     node.nodeInfo(),
+	})
+}
@@ -0,0 +1,216 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// Number of headers asked to a peer at once, it may send fewer
+const syncHeadersBatch = 500
+
+// Number of blocks asked to a peer at once
+const syncBlocksBatch = 100
+
+// Headers downloaded ahead of their blocks. Past this many the blocks are imported before more headers are asked for
+const maxPendingHeaders = 20 * syncHeadersBatch
+
+// The pending headers are written to headers.json once this many batches changed them, and when a sync phase ends.
+// Headers lost in a crash are downloaded again, the ones of blocks imported meanwhile are dropped on resume
+const headersCheckpointInterval = 10
+
+const headersFileName = "headers.json"
+
+// headersFile is the content of <datadir>/headers.json
+type headersFile struct {
+	Headers []database.HeaderFS `json:"headers"`
+}
+
+// headerQueue holds the verified headers whose blocks aren't imported yet, in chain order
+type headerQueue struct {
+	mu      sync.Mutex
+	headers []database.HeaderFS
+
+	// batches of changes since the headers were last written
+	unsaved int
+}
+
+func (q *headerQueue) pending() []database.HeaderFS {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]database.HeaderFS(nil), q.headers...)
+}
+
+func (q *headerQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.headers)
+}
+
+func (q *headerQueue) set(headers []database.HeaderFS) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.headers = append([]database.HeaderFS(nil), headers...)
+	q.unsaved++
+}
+
+func (q *headerQueue) append(headers []database.HeaderFS) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.headers = append(q.headers, headers...)
+	q.unsaved++
+}
+
+func (q *headerQueue) first() (database.HeaderFS, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.headers) == 0 {
+		return database.HeaderFS{}, false
+	}
+
+	return q.headers[0], true
+}
+
+func (q *headerQueue) last() (database.HeaderFS, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.headers) == 0 {
+		return database.HeaderFS{}, false
+	}
+
+	return q.headers[len(q.headers)-1], true
+}
+
+// dropThrough drops the headers up to the block number included
+func (q *headerQueue) dropThrough(number uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	dropped := sort.Search(len(q.headers), func(i int) bool {
+		return q.headers[i].Value.Number > number
+	})
+	if dropped == 0 {
+		return
+	}
+
+	q.headers = q.headers[dropped:]
+	q.unsaved++
+}
+
+// unsavedHeaders returns the headers to write when they changed since they were last written,
+// at least headersCheckpointInterval times unless force is set
+func (q *headerQueue) unsavedHeaders(force bool) ([]database.HeaderFS, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.unsaved == 0 || (!force && q.unsaved < headersCheckpointInterval) {
+		return nil, false
+	}
+
+	q.unsaved = 0
+
+	return append([]database.HeaderFS(nil), q.headers...), true
+}
+
+func getHeadersFilePath(dataDir string) string {
+	return filepath.Join(dataDir, headersFileName)
+}
+
+// loadHeaders reads the headers downloaded before the last restart, so the sync resumes where it stopped
+func (n *Node) loadHeaders() error {
+	headersJson, err := ioutil.ReadFile(getHeadersFilePath(n.dataDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	stored := headersFile{}
+	err = json.Unmarshal(headersJson, &stored)
+	if err != nil {
+		return fmt.Errorf("unable to read '%s'. %s", getHeadersFilePath(n.dataDir), err.Error())
+	}
+
+	n.headers.set(stored.Headers)
+	n.headers.unsavedHeaders(true)
+
+	return nil
+}
+
+// resetHeaders drops every pending header, and headers.json along with them
+func (n *Node) resetHeaders() error {
+	n.headers.set(nil)
+
+	return n.checkpointHeaders(true)
+}
+
+// checkpointHeaders writes the pending headers when they changed enough since they were last written, or at all with force
+func (n *Node) checkpointHeaders(force bool) error {
+	headers, ok := n.headers.unsavedHeaders(force)
+	if !ok {
+		return nil
+	}
+
+	return n.writeHeaders(headers)
+}
+
+// writeHeaders writes headers the way savePeers does, removing the file once empty
+func (n *Node) writeHeaders(headers []database.HeaderFS) error {
+	path := getHeadersFilePath(n.dataDir)
+	if len(headers) == 0 {
+		err := os.Remove(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	headersJson, err := json.Marshal(headersFile{Headers: headers})
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, headersJson, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// resumeHeaders drops the pending headers of the blocks imported meanwhile, or all of them
+// when they no longer chain on the local tip
+func (n *Node) resumeHeaders() error {
+	tip := n.localTip()
+	if !tip.Key.IsEmpty() {
+		n.headers.dropThrough(tip.Value.Number)
+	}
+
+	first, ok := n.headers.first()
+	if ok && ((tip.Key.IsEmpty() && first.Value.Number != 0) || database.VerifyHeaders(tip, []database.HeaderFS{first}) != nil) {
+		return n.resetHeaders()
+	}
+
+	return n.checkpointHeaders(false)
+}
+
+// localTip is the header of the latest block, empty before the first one
+func (n *Node) localTip() database.HeaderFS {
+	return n.state.LatestHeader()
+}
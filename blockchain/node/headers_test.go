@@ -0,0 +1,175 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// appendTestBlocks commits count empty blocks on top of the latest block of n
+func appendTestBlocks(t *testing.T, n *Node, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		_, err := n.state.AppendBlock(nil, uint64(time.Now().Unix()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func storedHeaders(t *testing.T, n *Node) int {
+	t.Helper()
+
+	headersJson, err := ioutil.ReadFile(getHeadersFilePath(n.dataDir))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := headersFile{}
+	err = json.Unmarshal(headersJson, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(stored.Headers)
+}
+
+func TestSyncHeadersFirstResumesAfterRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a chain longer than the pending headers cap")
+	}
+
+	const extra = 300
+
+	a := startTestNode(t)
+	appendTestBlocks(t, a, maxPendingHeaders+extra)
+
+	peer := testPeer(t, a)
+	status := a.status()
+	ctx := context.Background()
+
+	dataDir := newTestDataDir(t)
+	b := startTestNodeAt(t, dataDir)
+	tip := b.state.LatestBlockHash()
+
+	// the headers phase stops at the cap and checkpoints the headers, without importing any block
+	err := b.syncHeaders(ctx, peer, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending := b.headers.len(); pending != maxPendingHeaders {
+		t.Errorf("%d headers are pending, want %d", pending, maxPendingHeaders)
+	}
+	if stored := storedHeaders(t, b); stored != maxPendingHeaders {
+		t.Errorf("%d headers are stored, want %d", stored, maxPendingHeaders)
+	}
+	if b.state.LatestBlockHash() != tip {
+		t.Error("the headers phase imported blocks")
+	}
+
+	err = b.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the restarted node resumes from the stored headers, then imports every block
+	b = startTestNodeAt(t, dataDir)
+
+	if pending := b.headers.len(); pending != maxPendingHeaders {
+		t.Errorf("%d headers are pending after the restart, want %d", pending, maxPendingHeaders)
+	}
+
+	imported, err := b.syncBlocks(ctx, peer, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imported != maxPendingHeaders+extra {
+		t.Errorf("%d blocks were imported, want %d", imported, maxPendingHeaders+extra)
+	}
+	if b.state.LatestBlockHash() != status.Hash {
+		t.Errorf("b is at block %d, a at block %d", b.state.LatestBlock().Header.Number, status.Number)
+	}
+	if stored := storedHeaders(t, b); stored != 0 {
+		t.Errorf("%d headers are still stored once synced", stored)
+	}
+}
+
+// stallingProxy forwards the requests to n, except the headers requests past the first one which are held
+// until the client gives up
+func stallingProxy(t *testing.T, n *Node) PeerNode {
+	t.Helper()
+
+	target, err := url.Parse("http://" + n.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	headersRequests := int32(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == endpointHeaders && atomic.AddInt32(&headersRequests, 1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	addr := server.Listener.Addr().String()
+	host, rawPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.ParseUint(rawPort, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPeerNode(host, port, false, false)
+}
+
+func TestSyncHeadersPhaseIsBoundedByPeerTimeout(t *testing.T) {
+	const peerTimeout = 500 * time.Millisecond
+
+	a := startTestNode(t)
+	appendTestBlocks(t, a, 3*syncHeadersBatch)
+
+	peer := stallingProxy(t, a)
+	status := a.status()
+
+	b := startTestNode(t, WithSync(SyncConfig{PeerTimeout: peerTimeout, RequestTimeout: 10 * time.Second}))
+
+	start := time.Now()
+	imported, err := b.syncBlocks(context.Background(), peer, status)
+	elapsed := time.Since(start)
+
+	// the blocks of the headers downloaded before the timeout are imported anyway
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != syncHeadersBatch {
+		t.Errorf("%d blocks were imported, want the %d of the first headers batch", imported, syncHeadersBatch)
+	}
+	if elapsed > 5*peerTimeout {
+		t.Errorf("the sync took %s, the headers phase isn't bounded by the peer timeout of %s", elapsed, peerTimeout)
+	}
+}
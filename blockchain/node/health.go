@@ -0,0 +1,167 @@
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const endpointHealthz = "/healthz"
+const endpointReadyz = "/readyz"
+
+const DefaultMaxBlocksBehind = uint64(10)
+const DefaultMinConnectedPeers = 1
+const DefaultMaxFailedSyncRounds = 3
+
+// ReadinessConfig decides when a node is too far out of sync to serve queries
+type ReadinessConfig struct {
+	// Lag behind the best height reported by a connected peer above which the node isn't ready
+	MaxBlocksBehind uint64
+
+	// Number of joined peers below which the node isn't ready, 0 for a standalone node
+	MinConnectedPeers int
+
+	// Number of consecutive sync rounds without a single successful peer after which the node isn't ready
+	MaxFailedSyncRounds int
+}
+
+func DefaultReadinessConfig() ReadinessConfig {
+	return ReadinessConfig{
+		MaxBlocksBehind:     DefaultMaxBlocksBehind,
+		MinConnectedPeers:   DefaultMinConnectedPeers,
+		MaxFailedSyncRounds: DefaultMaxFailedSyncRounds,
+	}
+}
+
+func WithReadiness(cfg ReadinessConfig) Option {
+	return func(n *Node) {
+		n.readiness = cfg
+	}
+}
+
+// syncHealth is what doSync learned about the network, read by /readyz
+type syncHealth struct {
+	mu               sync.Mutex
+	failedSyncRounds int
+	lastSyncRound    time.Time
+}
+
+// recordSyncRound counts the rounds in a row where no peer could be synced with
+func (h *syncHealth) recordSyncRound(tried int, succeeded int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastSyncRound = time.Now()
+
+	if tried > 0 && succeeded == 0 {
+		h.failedSyncRounds++
+	} else {
+		h.failedSyncRounds = 0
+	}
+}
+
+type HealthRes struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type ReadyRes struct {
+	Ready            bool     `json:"ready"`
+	Reasons          []string `json:"reasons"`
+	Number           uint64   `json:"block_number"`
+	BestPeerNumber   uint64   `json:"best_peer_block_number"`
+	ConnectedPeers   int      `json:"peers_connected"`
+	FailedSyncRounds int      `json:"failed_sync_rounds"`
+	LastSyncRound    string   `json:"last_sync_round,omitempty"`
+
+	// Headers downloaded whose blocks are still to import
+	HeadersPending int `json:"headers_pending"`
+}
+
+// healthzHandler reports whether the process is up and can still write into its datadir
+func healthzHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	err := checkDirWritable(node.dataDir)
+	if err != nil {
+		writeResCode(w, HealthRes{Healthy: false, Error: err.Error()}, http.StatusServiceUnavailable)
+		return
+	}
+
+	writeRes(w, HealthRes{Healthy: true})
+}
+
+// readyzHandler reports whether the node is in sync enough with the network to serve queries
+func readyzHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	res := node.readinessStatus()
+	if !res.Ready {
+		writeResCode(w, res, http.StatusServiceUnavailable)
+		return
+	}
+
+	writeRes(w, res)
+}
+
+func (n *Node) readinessStatus() ReadyRes {
+	n.syncHealth.mu.Lock()
+	failedSyncRounds := n.syncHealth.failedSyncRounds
+	lastSyncRound := n.syncHealth.lastSyncRound
+	n.syncHealth.mu.Unlock()
+
+	// the heights the connected peers reported on their last sync, a peer which disconnects no longer counts
+	connected := 0
+	bestPeerHeight := uint64(0)
+	for _, peer := range n.KnownPeers() {
+		if !peer.connected {
+			continue
+		}
+
+		connected++
+		if peer.Height > bestPeerHeight {
+			bestPeerHeight = peer.Height
+		}
+	}
+
+	height := n.state.LatestBlock().Header.Number
+
+	res := ReadyRes{
+		Reasons:          make([]string, 0),
+		Number:           height,
+		BestPeerNumber:   bestPeerHeight,
+		ConnectedPeers:   connected,
+		FailedSyncRounds: failedSyncRounds,
+		HeadersPending:   n.headers.len(),
+	}
+
+	if !lastSyncRound.IsZero() {
+		res.LastSyncRound = lastSyncRound.UTC().Format(time.RFC3339)
+	}
+
+	if bestPeerHeight > height && bestPeerHeight-height > n.readiness.MaxBlocksBehind {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("%d blocks behind the best peer", bestPeerHeight-height))
+	}
+
+	if connected < n.readiness.MinConnectedPeers {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("%d connected peers, %d required", connected, n.readiness.MinConnectedPeers))
+	}
+
+	if n.readiness.MaxFailedSyncRounds > 0 && failedSyncRounds >= n.readiness.MaxFailedSyncRounds {
+		res.Reasons = append(res.Reasons, fmt.Sprintf("last %d sync rounds failed", failedSyncRounds))
+	}
+
+	res.Ready = len(res.Reasons) == 0
+
+	return res
+}
+
+func checkDirWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".healthz")
+	if err != nil {
+		return fmt.Errorf("datadir is not writable. %s", err.Error())
+	}
+
+	f.Close()
+
+	return os.Remove(f.Name())
+}
@@ -1,57 +1,83 @@
 package node
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/mycicle/MyChain/blockchain/node/client"
 	database "github.com/mycicle/MyChain/blockchain/src"
 )
 
-type ErrRes struct {
-	Error string `json:"error"`
-}
+// the request and response bodies are shared with the client package
+type ErrRes = client.ErrRes
+type SyncRes = client.SyncRes
+type HeadersRes = client.HeadersRes
+type SyncNowRes = client.SyncNowRes
+type PeerSyncRes = client.PeerSyncRes
+type BlocksRes = client.BlocksRes
+type BalancesRes = client.BalancesRes
+type TxAddReq = client.TxAddReq
+type TxAddRes = client.TxAddRes
+type TxBatchReq = client.TxBatchReq
+type TxBatchRes = client.TxBatchRes
+type TxResult = client.TxResult
+type TxSimulateRes = client.TxSimulateRes
+type StatusRes = client.StatusRes
+type AddPeerRes = client.AddPeerRes
+type PeersRes = client.PeersRes
+type BlockAnnounceReq = client.BlockAnnounceReq
+type AnnounceRes = client.AnnounceRes
+type TxAnnounceReq = client.TxAnnounceReq
+type MempoolAddRes = client.MempoolAddRes
+type MempoolRes = client.MempoolRes
+type MempoolCommitRes = client.MempoolCommitRes
+type PendingTx = client.PendingTx
 
-type SyncRes struct {
-	Blocks []database.Block `json:"blocks"`
-}
+func listBalancesHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	q, err := client.ParseBalancesQuery(r.URL.Query())
+	if err != nil {
+		writeErrResCode(w, err, http.StatusBadRequest)
+		return
+	}
 
-type BalancesRes struct {
-	Hash     database.Hash             `json:"block_hash"`
-	Balances map[database.Account]uint `json:"balances"`
-}
+	res, err := listBalances(state, q)
+	if err != nil {
+		writeErrResCode(w, err, http.StatusBadRequest)
+		return
+	}
 
-type TxAddReq struct {
-	From  string `json:"from"`
-	To    string `json:"to"`
-	Value uint   `json:"value"`
-	Data  string `json:"data"`
+	writeRes(w, res)
 }
 
-type TxAddRes struct {
-	Hash database.Hash `json:"block_hash"`
-}
+func listBalances(state *database.State, q database.BalancesQuery) (BalancesRes, error) {
+	snapshot := state.Snapshot()
 
-type StatusRes struct {
-	Hash       database.Hash       `json:"block_hash"`
-	Number     uint64              `json:"block_number"`
-	KnownPeers map[string]PeerNode `json:"peers_known"`
-}
+	page, err := database.QueryBalances(snapshot.Balances, q)
+	if err != nil {
+		return BalancesRes{}, err
+	}
 
-type AddPeerRes struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
-}
+	balances := make(map[database.Account]uint, len(page.Balances))
+	for _, b := range page.Balances {
+		balances[b.Account] = b.Balance
+	}
 
-func listBalancesHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
-	writeRes(w, BalancesRes{
-		Hash:     state.LatestBlockHash(),
-		Balances: state.Balances,
-	})
+	return BalancesRes{
+		Hash:         snapshot.LatestBlockHash,
+		Balances:     balances,
+		Accounts:     page.Balances,
+		NextCursor:   page.NextCursor,
+		Matched:      page.Matched,
+		AccountCount: page.AccountCount,
+		TotalSupply:  page.TotalSupply,
+	}, nil
 }
 
-func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	req := TxAddReq{}
 	err := readReq(r, &req)
 	if err != nil {
@@ -59,6 +85,22 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State)
 		return
 	}
 
+	hash, err := node.addTx(req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, TxAddRes{
+		Hash: hash,
+	})
+
+}
+
+// addTx adds the requested transaction to the mempool, gossiped to the peers as any pending one, then commits
+// the mempool right away. It answers the hash of the block committing the transaction, which is the block of
+// a concurrent commit when one took the transaction first
+func (n *Node) addTx(req TxAddReq) (database.Hash, error) {
 	tx := database.NewTx(
 		database.NewAccount(req.From),
 		database.NewAccount(req.To),
@@ -66,35 +108,171 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State)
 		req.Data,
 	)
 
-	block := database.NewBlock(
-		state.LatestBlockHash(),
-		state.NextBlockNumber(),
-		uint64(time.Now().Unix()),
-		[]database.Tx{tx},
-	)
+	txHash, err := n.addPendingTx(tx, "")
+	if err != nil {
+		return database.Hash{}, &statusError{code: pendingTxErrCode(err), msg: err.Error()}
+	}
 
-	hash, err := state.AddBlock(block)
+	_, err = n.state.Persist()
+	if err != nil && !errors.Is(err, database.ErrMempoolEmpty) {
+		return database.Hash{}, err
+	}
+
+	blockHash, committed := n.state.CommittedTxBlock(txHash)
+	if !committed {
+		return database.Hash{}, fmt.Errorf("transaction %x was dropped from the mempool before being committed", txHash)
+	}
+
+	return blockHash, nil
+}
+
+// txBatchHandler commits every transaction of the request in a single block, or none of them
+func txBatchHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	req := TxBatchReq{}
+	err := readReq(r, &req)
 	if err != nil {
 		writeErrRes(w, err)
 		return
 	}
 
-	writeRes(w, TxAddRes{
-		Hash: hash,
-	})
+	if len(req.Txs) == 0 {
+		writeErrResCode(w, fmt.Errorf("the batch has no transaction"), http.StatusBadRequest)
+		return
+	}
 
+	res, err := addTxBatch(state, req)
+	if errors.Is(err, database.ErrBatchRejected) {
+		writeResCode(w, res, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, res)
 }
 
-func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
-	res := StatusRes{
-		Hash:       node.state.LatestBlockHash(),
-		Number:     node.state.LatestBlock().Header.Number,
-		KnownPeers: node.knownPeers,
+func addTxBatch(state *database.State, req TxBatchReq) (TxBatchRes, error) {
+	txs, results, err := txsFromReqs(req.Txs)
+	if err != nil {
+		return TxBatchRes{}, err
+	}
+
+	res := TxBatchRes{Results: results}
+
+	hash, txErrs, err := state.AppendBatch(txs, uint64(time.Now().Unix()))
+	for i, txErr := range txErrs {
+		if txErr != nil {
+			res.Results[i].Error = txErr.Error()
+		}
+	}
+
+	if err != nil {
+		res.Error = err.Error()
+		return res, err
+	}
+
+	res.Accepted = true
+	res.Hash = hash
+
+	return res, nil
+}
+
+// txSimulateHandler reports what adding the transactions of the request as a batch would do, without adding them
+func txSimulateHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	req := TxBatchReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	if len(req.Txs) == 0 {
+		writeErrResCode(w, fmt.Errorf("the batch has no transaction"), http.StatusBadRequest)
+		return
+	}
+
+	res, err := simulateTxs(state, req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
 	}
 
 	writeRes(w, res)
 }
 
+func simulateTxs(state *database.State, req TxBatchReq) (TxSimulateRes, error) {
+	txs, results, err := txsFromReqs(req.Txs)
+	if err != nil {
+		return TxSimulateRes{}, err
+	}
+
+	deltas, txErrs := state.Simulate(txs)
+
+	res := TxSimulateRes{Valid: true, Deltas: deltas, Results: results}
+	for i, txErr := range txErrs {
+		if txErr != nil {
+			res.Results[i].Error = txErr.Error()
+			res.Valid = false
+		}
+	}
+
+	if !res.Valid {
+		res.Error = "the batch would be rejected"
+	}
+
+	return res, nil
+}
+
+// txsFromReqs builds the txs of a batch request along with the result of each, yet without error
+func txsFromReqs(reqs []TxAddReq) ([]database.Tx, []TxResult, error) {
+	txs := make([]database.Tx, len(reqs))
+	results := make([]TxResult, len(reqs))
+
+	for i, txReq := range reqs {
+		txs[i] = database.NewTx(
+			database.NewAccount(txReq.From),
+			database.NewAccount(txReq.To),
+			txReq.Value,
+			txReq.Data,
+		)
+
+		txHash, err := txs[i].Hash()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		results[i] = TxResult{Index: i, Hash: txHash}
+	}
+
+	return txs, results, nil
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	writeRes(w, node.status())
+}
+
+func (n *Node) status() StatusRes {
+	now := time.Now()
+
+	// banned peers aren't shared, so they don't spread through the network
+	knownPeers := make(map[string]client.Peer)
+	for tcpAddress, peer := range n.KnownPeers() {
+		if !peer.isBanned(now) {
+			knownPeers[tcpAddress] = peer.toClientPeer()
+		}
+	}
+
+	snapshot := n.state.Snapshot()
+
+	return StatusRes{
+		Hash:       snapshot.LatestBlockHash,
+		Number:     snapshot.LatestBlock.Header.Number,
+		KnownPeers: knownPeers,
+	}
+}
+
 func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	reqHash := r.URL.Query().Get(endpointSyncQueryKeyFromBlock)
 
@@ -105,7 +283,7 @@ func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 		return
 	}
 
-	blocks, err := database.GetBlocksAfter(hash, node.dataDir)
+	blocks, more, err := database.GetBlocksAfter(hash, node.dataDir, node.limits.MaxSyncBlocks)
 	if err != nil {
 		writeErrRes(w, err)
 		return
@@ -113,30 +291,167 @@ func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 
 	writeRes(w, SyncRes{
 		Blocks: blocks,
+		More:   more,
 	})
 }
 
-func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
-	peerIP := r.URL.Query().Get(endpointAddPeerQueryKeyIP)
-	peerPortRaw := r.URL.Query().Get(endpointAddPeerQueryKeyPort)
+// headersHandler serves the headers of the blocks stored after the requested one, 404 if it isn't stored
+func headersHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	hash := database.Hash{}
+	err := hash.UnmarshalText([]byte(r.URL.Query().Get(endpointHeadersQueryKeyFromBlock)))
+	if err != nil {
+		writeErrResCode(w, fmt.Errorf("invalid block hash. %s", err.Error()), http.StatusBadRequest)
+		return
+	}
 
-	peerPort, err := strconv.ParseUint(peerPortRaw, 10, 32)
+	limit, err := syncLimit(r, node.limits.MaxSyncHeaders)
 	if err != nil {
-		writeRes(w, AddPeerRes{
-			false,
-			err.Error(),
-		})
+		writeErrResCode(w, err, http.StatusBadRequest)
 		return
 	}
 
-	peer := NewPeerNode(peerIP, peerPort, false, true)
+	res, err := node.headersAfter(hash, limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
 
-	node.AddPeer(peer)
+	writeRes(w, res)
+}
 
-	fmt.Printf("Peer '%s' was added into KnownPeers\n", peer.TcpAddress())
+// headersAfter reads at most limit headers of the blocks stored after hash, failing with a 404 statusError
+// if hash isn't stored
+func (n *Node) headersAfter(hash database.Hash, limit int) (HeadersRes, error) {
+	headers, more, err := database.GetHeadersAfter(hash, n.dataDir, limit)
+	if errors.Is(err, database.ErrBlockNotFound) {
+		return HeadersRes{}, &statusError{code: http.StatusNotFound, msg: fmt.Sprintf("block '%x' not found", hash)}
+	}
+	if err != nil {
+		return HeadersRes{}, err
+	}
+
+	return HeadersRes{
+		Headers: headers,
+		More:    more,
+	}, nil
+}
+
+// blocksHandler serves the blocks starting with the requested number
+func blocksHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	number, err := strconv.ParseUint(r.URL.Query().Get(endpointBlocksQueryKeyFromNumber), 10, 64)
+	if err != nil {
+		writeErrResCode(w, fmt.Errorf("invalid block number. %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := syncLimit(r, node.limits.MaxSyncBlocks)
+	if err != nil {
+		writeErrResCode(w, err, http.StatusBadRequest)
+		return
+	}
 
+	blocks, more, err := database.GetBlocksFrom(number, node.dataDir, limit)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, BlocksRes{
+		Blocks: blocks,
+		More:   more,
+	})
+}
+
+// syncNowHandler runs a sync round right away, for operators who can't wait for the next one
+func syncNowHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	res, err := node.SyncNow(r.Context())
+	if err != nil {
+		writeErrResCode(w, err, http.StatusServiceUnavailable)
+		return
+	}
+
+	writeRes(w, res)
+}
+
+// syncLimit reads the number of items asked for, capped to max unless max is 0
+func syncLimit(r *http.Request, max int) (int, error) {
+	raw := r.URL.Query().Get(endpointSyncQueryKeyLimit)
+	if raw == "" {
+		return max, nil
+	}
+
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit '%s', expected a positive number", raw)
+	}
+
+	return capLimit(limit, max)
+}
+
+// capLimit caps the number of items asked for to max unless max is 0
+func capLimit(limit int, max int) (int, error) {
+	if limit <= 0 {
+		return 0, fmt.Errorf("invalid limit '%d', expected a positive number", limit)
+	}
+
+	if max > 0 && limit > max {
+		return max, nil
+	}
+
+	return limit, nil
+}
+
+// addPeerHandler refuses the nodes which join with the query string of protocol version 1, telling them to upgrade
+func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, AddPeerRes{
-		true,
-		"",
+		Success: false,
+		Error:   fmt.Sprintf("protocol version 1 is too old, versions %d to %d are supported: upgrade the node to join with a handshake on %s", MinProtocolVersion, ProtocolVersion, endpointHandshake),
 	})
 }
+
+// peersHandler lists the known peers with their score and ban status, best scores first
+func peersHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	writeRes(w, node.peers())
+}
+
+func (n *Node) peers() PeersRes {
+	now := time.Now()
+
+	res := PeersRes{Peers: make([]client.PeerInfo, 0)}
+	for _, peer := range n.KnownPeers() {
+		info := client.PeerInfo{
+			Peer:            peer.toClientPeer(),
+			Connected:       peer.connected,
+			Number:          peer.Height,
+			NodeID:          peer.NodeID,
+			ProtocolVersion: peer.ProtocolVersion,
+			Features:        peer.Features,
+			TCPPort:         peer.TCPPort,
+			Score:           peer.Score,
+			Successes:       peer.Successes,
+			Failures:        peer.Failures,
+			Bans:            peer.Bans,
+			LastSeen:        peer.LastSeen,
+			Banned:          peer.isBanned(now),
+		}
+
+		if info.Banned {
+			info.BannedUntil = peer.BannedUntil
+		}
+		if peer.isBackedOff(now) {
+			info.RetryAt = peer.RetryAt
+		}
+
+		res.Peers = append(res.Peers, info)
+	}
+
+	sort.Slice(res.Peers, func(i, j int) bool {
+		if res.Peers[i].Score != res.Peers[j].Score {
+			return res.Peers[i].Score > res.Peers[j].Score
+		}
+
+		return res.Peers[i].TcpAddress() < res.Peers[j].TcpAddress()
+	})
+
+	return res
+}
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// Txs added faster than they are gossiped are only known by this node past this many
+const txAnnounceQueueSize = 256
+
+const seenTxsCapacity = 4096
+
+// mempoolAddHandler adds a transaction to the mempool and gossips it to the peers, without committing it
+func mempoolAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	req := TxAddReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	tx := database.NewTx(
+		database.NewAccount(req.From),
+		database.NewAccount(req.To),
+		req.Value,
+		req.Data,
+	)
+
+	hash, err := node.addPendingTx(tx, "")
+	if err != nil {
+		writeErrResCode(w, err, pendingTxErrCode(err))
+		return
+	}
+
+	writeRes(w, MempoolAddRes{Hash: hash})
+}
+
+// pendingTxErrCode is the status code answered when addPendingTx fails with err: a conflict for the
+// transactions already known, unprocessable for the invalid ones
+func pendingTxErrCode(err error) int {
+	if errors.Is(err, errTxSeen) || errors.Is(err, database.ErrTxPending) || errors.Is(err, database.ErrTxCommitted) {
+		return http.StatusConflict
+	}
+
+	return http.StatusUnprocessableEntity
+}
+
+func mempoolListHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	res := MempoolRes{Txs: make([]PendingTx, 0)}
+	for _, tx := range node.state.PendingTxs() {
+		hash, err := tx.Hash()
+		if err != nil {
+			writeErrRes(w, err)
+			return
+		}
+
+		res.Txs = append(res.Txs, PendingTx{Hash: hash, Tx: tx})
+	}
+
+	writeRes(w, res)
+}
+
+// mempoolCommitHandler commits the pending transactions in a new block, announced to the peers as any other
+func mempoolCommitHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	txs := node.state.MempoolSize()
+	if txs == 0 {
+		writeErrResCode(w, fmt.Errorf("no pending transaction to commit"), http.StatusBadRequest)
+		return
+	}
+
+	hash, err := node.state.Persist()
+	if errors.Is(err, database.ErrMempoolEmpty) {
+		writeErrResCode(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, MempoolCommitRes{Hash: hash, Txs: txs})
+}
+
+// txAnnounceHandler adds a transaction gossiped by a peer to the mempool, and gossips it further
+func txAnnounceHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	req := TxAnnounceReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	res, code := node.receiveTx(req)
+	writeResCode(w, res, code)
+}
+
+func (n *Node) receiveTx(req TxAnnounceReq) (AnnounceRes, int) {
+	_, err := n.addPendingTx(req.Tx, req.From)
+	if errors.Is(err, errTxSeen) || errors.Is(err, database.ErrTxPending) || errors.Is(err, database.ErrTxCommitted) {
+		return AnnounceRes{Known: true}, http.StatusOK
+	}
+	if err != nil {
+		// the peer may not have seen a block spending the same balance yet, it isn't penalised
+		return AnnounceRes{Error: err.Error()}, http.StatusUnprocessableEntity
+	}
+
+	return AnnounceRes{Accepted: true}, http.StatusOK
+}
+
+var errTxSeen = errors.New("transaction was already seen")
+
+// addPendingTx validates tx against the pending state, adds it to the mempool and queues it for gossip.
+// origin is the address of the peer that sent it, empty when it was submitted to this node
+func (n *Node) addPendingTx(tx database.Tx, origin string) (database.Hash, error) {
+	hash, err := tx.Hash()
+	if err != nil {
+		return database.Hash{}, err
+	}
+
+	if _, seen := n.seenTxs.origin(hash); seen {
+		return hash, errTxSeen
+	}
+
+	// invalid txs aren't remembered as seen, they may become valid once a pending block is received
+	err = n.state.AddTx(tx)
+	if err != nil {
+		return hash, err
+	}
+
+	n.seenTxs.add(hash, origin)
+
+	select {
+	case n.txAnnouncements <- tx:
+	default:
+		fmt.Printf("WARNING: too many transactions to gossip, TX %x is only pending on this node\n", hash)
+	}
+
+	return hash, nil
+}
+
+func (n *Node) announceTx(ctx context.Context, tx database.Tx) {
+	hash, err := tx.Hash()
+	if err != nil {
+		return
+	}
+
+	origin, _ := n.seenTxs.origin(hash)
+	req := TxAnnounceReq{From: n.Addr(), Tx: tx}
+
+	n.broadcast(ctx, origin, FeatureTxGossip, fmt.Sprintf("TX %x", hash), func(ctx context.Context, peer Transport) error {
+		_, err := peer.AnnounceTx(ctx, req)
+		return err
+	})
+}
@@ -0,0 +1,213 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/metrics"
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+const endpointMetrics = "/metrics"
+
+type nodeMetrics struct {
+	registry *metrics.Registry
+
+	syncRoundDuration   *metrics.Histogram
+	syncErrors          *metrics.Counter
+	peerSyncErrors      *metrics.Counter
+	httpRequests        *metrics.Counter
+	httpRequestDuration *metrics.Histogram
+	tcpRequests         *metrics.Counter
+	tcpRequestDuration  *metrics.Histogram
+}
+
+func newNodeMetrics(n *Node) *nodeMetrics {
+	r := metrics.NewRegistry()
+
+	r.NewGaugeFunc("tbb_chain_height", "Number of the latest block.", func() float64 {
+		if n.state == nil {
+			return 0
+		}
+
+		return float64(n.state.LatestBlock().Header.Number)
+	})
+
+	r.NewGaugeFunc("tbb_chain_tip_age_seconds", "Seconds since the latest block was produced.", func() float64 {
+		if n.state == nil || n.state.LatestBlockHash().IsEmpty() {
+			return 0
+		}
+
+		blockTime := time.Unix(int64(n.state.LatestBlock().Header.Time), 0)
+
+		return time.Since(blockTime).Seconds()
+	})
+
+	r.NewGaugeFunc("tbb_peers_known", "Number of known peers.", func() float64 {
+		return float64(len(n.KnownPeers()))
+	})
+
+	r.NewGaugeFunc("tbb_peers_connected", "Number of known peers this node has joined.", func() float64 {
+		connected := 0
+		for _, peer := range n.KnownPeers() {
+			if peer.connected {
+				connected++
+			}
+		}
+
+		return float64(connected)
+	})
+
+	r.NewGaugeFunc("tbb_sync_headers_pending", "Number of headers downloaded whose blocks are still to import.", func() float64 {
+		return float64(n.headers.len())
+	})
+
+	r.NewGaugeFunc("tbb_mempool_size", "Number of transactions waiting in the mempool.", func() float64 {
+		if n.state == nil {
+			return 0
+		}
+
+		return float64(n.state.MempoolSize())
+	})
+
+	r.NewCounterFunc("tbb_blocks_applied_total", "Blocks committed to the state since the node started.", func() float64 {
+		if n.state == nil {
+			return 0
+		}
+
+		return float64(n.state.BlocksApplied())
+	})
+
+	r.NewCounterFunc("tbb_txs_applied_total", "Transactions committed to the state since the node started.", func() float64 {
+		if n.state == nil {
+			return 0
+		}
+
+		return float64(n.state.TxsApplied())
+	})
+
+	return &nodeMetrics{
+		registry: r,
+
+		syncRoundDuration: r.NewHistogram(
+			"tbb_sync_round_duration_seconds",
+			"Duration of a sync round against every known peer.",
+			[]float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 120},
+		),
+		syncErrors: r.NewCounter(
+			"tbb_sync_errors_total",
+			"Failed sync steps per reason.",
+			"reason",
+		),
+		peerSyncErrors: r.NewCounter(
+			"tbb_peer_sync_errors_total",
+			"Failed sync steps per known peer and reason, dropped once the peer is pruned or banned.",
+			"peer", "reason",
+		),
+		httpRequests: r.NewCounter(
+			"tbb_http_requests_total",
+			"HTTP requests served per route, method and status code.",
+			"route", "method", "code",
+		),
+		httpRequestDuration: r.NewHistogram(
+			"tbb_http_request_duration_seconds",
+			"Latency of the HTTP requests served per route.",
+			metrics.DefBuckets,
+			"route",
+		),
+		tcpRequests: r.NewCounter(
+			"tbb_tcp_requests_total",
+			"Requests served over the TCP transport per op and status code.",
+			"op", "code",
+		),
+		tcpRequestDuration: r.NewHistogram(
+			"tbb_tcp_request_duration_seconds",
+			"Latency of the requests served over the TCP transport per op.",
+			metrics.DefBuckets,
+			"op",
+		),
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	node.metrics.registry.WriteText(w)
+}
+
+// instrument counts the requests served by handler and measures their latency under route
+func (n *Node) instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		handler(rec, r)
+
+		n.metrics.httpRequests.Inc(route, methodLabel(r.Method), strconv.Itoa(rec.status))
+		n.metrics.httpRequestDuration.Observe(time.Since(start).Seconds(), route)
+	}
+}
+
+// methodLabel keeps the methods sent by clients from growing the number of series, the unusual ones count as "other"
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+
+	return "other"
+}
+
+// recordSyncError counts a failed sync step with peer. The step is only counted under the peer while it is known,
+// so the number of series per peer is bounded by the known peers, see forgetPeerMetrics
+func (n *Node) recordSyncError(peer PeerNode, err error) {
+	reason := syncErrorReason(err)
+	n.metrics.syncErrors.Inc(reason)
+
+	if _, known := n.knownPeer(peer.TcpAddress()); known {
+		n.metrics.peerSyncErrors.Inc(peer.TcpAddress(), reason)
+	}
+}
+
+// forgetPeerMetrics drops the series of the peer at tcpAddress, once it is pruned or banned
+func (n *Node) forgetPeerMetrics(tcpAddress string) {
+	n.metrics.peerSyncErrors.DeleteLabel("peer", tcpAddress)
+}
+
+// syncErrorReason classifies a failed sync step the way recordPeerFailure does
+func syncErrorReason(err error) string {
+	var invalidBlockErr *database.InvalidBlockError
+	var decodeErr *client.DecodeError
+	var handshakeErr *client.HandshakeError
+	var apiErr *client.APIError
+	var connErr *client.ConnError
+
+	switch {
+	case errors.As(err, &invalidBlockErr):
+		return "invalid_block"
+	case errors.As(err, &decodeErr):
+		return "malformed_response"
+	case errors.As(err, &handshakeErr):
+		return "incompatible"
+	case errors.As(err, &apiErr):
+		return "error_response"
+	case errors.As(err, &connErr):
+		return "unreachable"
+	}
+
+	return "other"
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
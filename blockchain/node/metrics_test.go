@@ -0,0 +1,96 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+func peerSyncErrorsSeries(t *testing.T, n *Node, peer PeerNode) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := n.metrics.registry.WriteText(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := make([]string, 0)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, fmt.Sprintf(`tbb_peer_sync_errors_total{peer="%s"`, peer.TcpAddress())) {
+			series = append(series, line)
+		}
+	}
+
+	return strings.Join(series, "\n")
+}
+
+func TestPeerSyncErrors(t *testing.T) {
+	unreachable := &client.ConnError{Endpoint: "/node/status", Err: errors.New("connection refused")}
+	invalidBlock := &database.InvalidBlockError{Number: 1, Err: errors.New("invalid parent")}
+
+	tests := []struct {
+		name   string
+		known  bool
+		errs   []error
+		forget func(n *Node, peer PeerNode)
+		want   string
+	}{
+		{
+			name:  "known peer",
+			known: true,
+			errs:  []error{unreachable, unreachable, invalidBlock},
+			want: `tbb_peer_sync_errors_total{peer="127.0.0.1:9001",reason="invalid_block"} 1` + "\n" +
+				`tbb_peer_sync_errors_total{peer="127.0.0.1:9001",reason="unreachable"} 2`,
+		},
+		{
+			name:  "unknown peer",
+			known: false,
+			errs:  []error{unreachable},
+			want:  "",
+		},
+		{
+			name:   "removed peer",
+			known:  true,
+			errs:   []error{unreachable},
+			forget: func(n *Node, peer PeerNode) { n.RemovePeer(peer) },
+			want:   "",
+		},
+		{
+			name:  "banned peer",
+			known: true,
+			errs:  []error{unreachable},
+			forget: func(n *Node, peer PeerNode) {
+				n.recordPeerFailure(peer, invalidBlock)
+				n.recordPeerFailure(peer, invalidBlock)
+			},
+			want: "",
+		},
+	}
+
+	for _, test := range tests {
+		n := New(t.TempDir())
+		peer := NewPeerNode("127.0.0.1", 9001, false, false)
+
+		if test.known {
+			n.AddPeer(peer)
+		}
+
+		for _, err := range test.errs {
+			n.recordSyncError(peer, err)
+		}
+
+		if test.forget != nil {
+			test.forget(n, peer)
+		}
+
+		if got := peerSyncErrorsSeries(t, n, peer); got != test.want {
+			t.Errorf("%s: got series\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
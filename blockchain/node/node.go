@@ -2,61 +2,308 @@ package node
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/mycicle/MyChain/blockchain/node/client"
 	database "github.com/mycicle/MyChain/blockchain/src"
 )
 
 const DefaultIP = "127.0.0.1"
 const DefaultHTTPort = uint64(8080)
-const endpointStatus = "/node/status"
 
-const endpointSync = "/node/sync"
-const endpointSyncQueryKeyFromBlock = "fromBlock"
+// How long in-flight requests are given to complete once the node is asked to stop
+const ShutdownTimeout = 10 * time.Second
 
-const endpointAddPeer = "/node/peer"
-const endpointAddPeerQueryKeyIP = "ip"
-const endpointAddPeerQueryKeyPort = "port"
+const endpointBalancesList = client.EndpointBalancesList
+const endpointTxAdd = client.EndpointTxAdd
+const endpointTxBatch = client.EndpointTxBatch
+const endpointTxSimulate = client.EndpointTxSimulate
+const endpointMempoolAdd = client.EndpointMempoolAdd
+const endpointMempoolList = client.EndpointMempoolList
+const endpointMempoolCommit = client.EndpointMempoolCommit
+const endpointStatus = client.EndpointStatus
+
+const endpointSync = client.EndpointSync
+const endpointSyncQueryKeyFromBlock = client.EndpointSyncQueryKeyFromBlock
+
+const endpointHeaders = client.EndpointHeaders
+const endpointHeadersQueryKeyFromBlock = client.EndpointHeadersQueryKeyFromBlock
+const endpointBlocks = client.EndpointBlocks
+const endpointBlocksQueryKeyFromNumber = client.EndpointBlocksQueryKeyFromNumber
+const endpointSyncQueryKeyLimit = client.EndpointSyncQueryKeyLimit
+const endpointSyncNow = client.EndpointSyncNow
+
+const endpointPeers = client.EndpointPeers
+const endpointBlock = client.EndpointBlock
+const endpointTx = client.EndpointTx
+
+const endpointAddPeer = client.EndpointAddPeer
 
 type PeerNode struct {
 	IP          string `json:"ip"`
 	Port        uint64 `json:"port"`
 	IsBootstrap bool   `json:"is_bootstrap"`
 
+	// Unix times the peer was first known and last answered a sync, 0 if it never did
+	AddedAt  uint64 `json:"added_at"`
+	LastSeen uint64 `json:"last_seen"`
+
+	// Latest block number the peer reported
+	Height uint64 `json:"block_number"`
+
+	// Negotiated during the last handshake between the nodes
+	NodeID          string   `json:"node_id,omitempty"`
+	ProtocolVersion uint     `json:"protocol_version,omitempty"`
+	Features        []string `json:"features,omitempty"`
+	TCPPort         uint64   `json:"tcp_port,omitempty"`
+
+	// Number of sync rounds with this peer which succeeded and failed
+	Successes uint64 `json:"successes"`
+	Failures  uint64 `json:"failures"`
+
+	// Score rises with successful syncs and drops with invalid blocks and malformed responses, see PeerScoring
+	Score int    `json:"score"`
+	Bans  uint64 `json:"bans"`
+
+	// Unix times until which the peer is banned, and before which it isn't retried after failing
+	BannedUntil         uint64 `json:"banned_until"`
+	RetryAt             uint64 `json:"retry_at"`
+	ConsecutiveFailures uint64 `json:"consecutive_failures"`
+
 	// Whenever my node has already established a connection, sync with this Peer
 	connected bool
+
+	// Whether the peer presented valid credentials when it joined this node, see isTrustedPeer
+	authenticated bool
 }
 
 func (pn PeerNode) TcpAddress() string {
-	return fmt.Sprintf("%s:%d", pn.IP, pn.Port)
+	return hostPort(pn.IP, pn.Port)
+}
+
+// hostPort joins ip and port into an address to dial, IPv6 addresses being put between brackets
+func hostPort(ip string, port uint64) string {
+	return net.JoinHostPort(ip, strconv.FormatUint(port, 10))
+}
+
+func (pn PeerNode) toClientPeer() client.Peer {
+	return client.Peer{
+		IP:          pn.IP,
+		Port:        pn.Port,
+		IsBootstrap: pn.IsBootstrap,
+	}
 }
 
 type Node struct {
 	dataDir string
+	id      string
 	ip      string
 	port    uint64
 
 	// To inject the State into HTTP handlers
 	state *database.State
 
+	// knownPeers is written by the sync loop and the HTTP handlers at the same time
+	peersMu    sync.RWMutex
 	knownPeers map[string]PeerNode
+
+	// Shared by the clients of every peer so connections are kept alive between sync rounds.
+	// peerTransport is its transport, nil when WithHTTPClient provided a custom client
+	httpClient    *http.Client
+	peerTransport *http.Transport
+
+	syncConfig SyncConfig
+
+	// SyncNow hands the sync loop a channel to send the result of the round back
+	syncRequests chan chan []PeerSyncRes
+
+	metrics *nodeMetrics
+
+	auth AuthConfig
+
+	// Nonces of the signed requests accepted, see checkCredentials
+	signatureNonces *nonceCache
+
+	limits      Limits
+	rateLimiter *rateLimiter
+
+	// Known peers not seen for longer are forgotten
+	peerMaxAge time.Duration
+	scoring    PeerScoring
+
+	// Bootstrap peers given by hostname, and the peers they resolved to. Only used by the sync loop
+	seeds               []Seed
+	seedPeers           map[string]map[string]PeerNode
+	seedResolveInterval time.Duration
+	seedsResolvedAt     time.Time
+
+	tls  TLSConfig
+	cors CORSConfig
+
+	readiness  ReadinessConfig
+	syncHealth syncHealth
+
+	// Headers verified during sync whose blocks aren't imported yet, kept in <datadir>/headers.json
+	headers headerQueue
+
+	// Each node routes its own requests so several nodes can run in one process
+	mux       *http.ServeMux
+	listener  net.Listener
+	server    *http.Server
+	serverErr chan error
+
+	// Optional TCP transport, see WithTCP. tcpConns are the connections served, nil once the node stops
+	tcpEnabled  bool
+	tcpPort     uint64
+	tcpListener net.Listener
+	tcpMu       sync.Mutex
+	tcpConns    map[net.Conn]struct{}
+	tcpWorkers  sync.WaitGroup
+
+	// Connections to the TCP transport of the peers
+	tcpPool *tcpPool
+
+	// Optional LAN discovery, see WithDiscovery
+	discovery        DiscoveryConfig
+	discoveryEnabled bool
+
+	// Blocks committed by the state and pending txs, announced to the peers, and the ones announced to this node
+	blockAnnouncements chan database.BlockFS
+	seenBlocks         *seenCache
+	txAnnouncements    chan database.Tx
+	seenTxs            *seenCache
+
+	// ctx is done once the node is stopping, stopSync cancels it
+	ctx      context.Context
+	stopSync context.CancelFunc
+	syncDone chan struct{}
+	workers  sync.WaitGroup
+	stopped  chan struct{}
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// Option configures a Node created by New
+type Option func(n *Node)
+
+// WithIP sets the IP the node announces to its peers
+func WithIP(ip string) Option {
+	return func(n *Node) {
+		n.ip = ip
+	}
+}
+
+// WithPort sets the port the HTTP API listens on. With 0 a free port is picked when the node starts, see Addr
+func WithPort(port uint64) Option {
+	return func(n *Node) {
+		n.port = port
+	}
+}
+
+// WithBootstrap adds peers the node syncs with from the start
+func WithBootstrap(peers ...PeerNode) Option {
+	return func(n *Node) {
+		for _, peer := range peers {
+			if peer.IsBootstrap {
+				n.addBootstrapPeer(peer)
+				continue
+			}
+
+			n.AddPeer(peer)
+		}
+	}
+}
+
+func WithAuth(auth AuthConfig) Option {
+	return func(n *Node) {
+		n.auth = auth
+	}
 }
 
-func New(dataDir string, ip string, port uint64, bootstrap PeerNode) *Node {
-	knownPeers := make(map[string]PeerNode)
-	knownPeers[bootstrap.TcpAddress()] = bootstrap
+func WithLimits(limits Limits) Option {
+	return func(n *Node) {
+		n.limits = limits
+	}
+}
 
-	return &Node{
-		dataDir:    dataDir,
-		ip:         ip,
-		port:       port,
-		knownPeers: knownPeers,
+// WithHTTPClient sets the http.Client used to query peers
+func WithHTTPClient(hc *http.Client) Option {
+	return func(n *Node) {
+		n.httpClient = hc
+		n.peerTransport = nil
 	}
 }
 
+// New creates a node storing its database in dataDir, listening on DefaultIP:DefaultHTTPort
+// with the peers known before its last restart, unless configured otherwise by opts
+func New(dataDir string, opts ...Option) *Node {
+	transport := newPeerTransport()
+
+	n := &Node{
+		dataDir:             dataDir,
+		ip:                  DefaultIP,
+		port:                DefaultHTTPort,
+		knownPeers:          make(map[string]PeerNode),
+		httpClient:          &http.Client{Transport: transport},
+		peerTransport:       transport,
+		syncConfig:          DefaultSyncConfig(),
+		syncRequests:        make(chan chan []PeerSyncRes),
+		limits:              DefaultLimits(),
+		readiness:           DefaultReadinessConfig(),
+		peerMaxAge:          DefaultPeerMaxAge,
+		scoring:             DefaultPeerScoring(),
+		seedPeers:           make(map[string]map[string]PeerNode),
+		seedResolveInterval: DefaultSeedResolveInterval,
+		rateLimiter:         newRateLimiter(),
+		signatureNonces:     newNonceCache(),
+		blockAnnouncements:  make(chan database.BlockFS, blockAnnounceQueueSize),
+		seenBlocks:          newSeenCache(seenBlocksCapacity),
+		txAnnouncements:     make(chan database.Tx, txAnnounceQueueSize),
+		seenTxs:             newSeenCache(seenTxsCapacity),
+		tcpConns:            make(map[net.Conn]struct{}),
+		mux:                 http.NewServeMux(),
+		stopped:             make(chan struct{}),
+	}
+
+	n.tcpPool = newTCPPool(n.dialTCP)
+
+	id, err := loadNodeID(dataDir)
+	if err != nil {
+		fmt.Printf("WARNING: unable to load the node ID, peers will refuse the handshake. %s\n", err)
+	}
+	n.id = id
+
+	err = n.loadPeers()
+	if err != nil {
+		fmt.Printf("WARNING: unable to load the known peers. %s\n", err)
+	}
+
+	err = n.loadHeaders()
+	if err != nil {
+		fmt.Printf("WARNING: unable to load the pending headers, they will be downloaded again. %s\n", err)
+	}
+
+	for _, opt := range opts {
+		opt(n)
+	}
+
+	n.prunePeers(time.Now())
+
+	n.metrics = newNodeMetrics(n)
+	n.registerRoutes()
+
+	return n
+}
+
 func NewPeerNode(ip string, port uint64, isBootstrap bool, connected bool) PeerNode {
 	return PeerNode{
 		IP:          ip,
@@ -66,76 +313,409 @@ func NewPeerNode(ip string, port uint64, isBootstrap bool, connected bool) PeerN
 	}
 }
 
-func (n *Node) Run() error {
-	ctx := context.Background()
-	fmt.Println(fmt.Sprintf("Listening on %s:%d", n.ip, n.port))
+// Run starts the node and blocks until ctx is cancelled, then stops it
+func (n *Node) Run(ctx context.Context) error {
+	err := n.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err = <-n.serverErr:
+	case <-ctx.Done():
+	case <-n.stopped:
+	}
+
+	stopErr := n.Stop()
+	if err != nil {
+		return err
+	}
+
+	return stopErr
+}
+
+// Start loads the state, binds the HTTP API, and the TCP transport if enabled, and starts syncing with the known peers, then returns.
+// The node runs until Stop is called or ctx is cancelled
+func (n *Node) Start(ctx context.Context) error {
+	if n.server != nil {
+		return fmt.Errorf("node is already started")
+	}
+
+	tlsConfig, err := n.setupTLS()
+	if err != nil {
+		return err
+	}
 
 	state, err := database.NewStateFromDisk(n.dataDir)
 	if err != nil {
 		return err
 	}
-	defer state.Close()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", n.port))
+	if err != nil {
+		state.Close()
+		return err
+	}
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	if n.tcpEnabled {
+		tcpListener, err := net.Listen("tcp", fmt.Sprintf(":%d", n.tcpPort))
+		if err != nil {
+			listener.Close()
+			state.Close()
+			return err
+		}
+
+		if tlsConfig != nil {
+			tcpListener = tls.NewListener(tcpListener, tlsConfig)
+		}
+
+		n.tcpListener = tcpListener
+		n.tcpPort = uint64(tcpListener.Addr().(*net.TCPAddr).Port)
+	}
+
+	var discoveryConn *net.UDPConn
+	if n.discoveryEnabled {
+		discoveryConn, err = n.listenDiscovery()
+		if err != nil {
+			if n.tcpListener != nil {
+				n.tcpListener.Close()
+			}
+			listener.Close()
+			state.Close()
+			return fmt.Errorf("unable to listen for LAN discovery. %s", err.Error())
+		}
+	}
 
 	n.state = state
+	n.state.OnBlockAdded(n.queueBlockAnnouncement)
+	n.listener = listener
+	n.ctx, n.stopSync = context.WithCancel(ctx)
+	n.port = uint64(listener.Addr().(*net.TCPAddr).Port)
+
+	fmt.Println(fmt.Sprintf("Listening on %s://%s", n.peerScheme(), n.Addr()))
 
-	go n.sync(ctx)
+	if n.tcpListener != nil {
+		fmt.Printf("Serving the TCP transport on %s\n", n.TCPAddr())
+	}
+
+	if !n.auth.Enabled() {
+		fmt.Println("WARNING: no API token nor HMAC secret configured, every route is public")
+	}
+
+	n.server = &http.Server{Handler: n.mux}
+	n.serverErr = make(chan error, 1)
+	go func() {
+		err := n.server.Serve(listener)
+		if err != http.ErrServerClosed {
+			n.serverErr <- err
+		}
+	}()
+
+	if n.tcpListener != nil {
+		n.tcpWorkers.Add(1)
+		go n.serveTCP(n.tcpListener)
+	}
+
+	n.syncDone = make(chan struct{})
+	go func() {
+		n.sync(n.ctx)
+		close(n.syncDone)
+	}()
+
+	n.workers.Add(1)
+	go func() {
+		defer n.workers.Done()
+		n.propagate(n.ctx)
+	}()
+
+	if discoveryConn != nil {
+		fmt.Printf("Discovering peers on %s:%d\n", n.discovery.Addr, n.discovery.Port)
+
+		n.workers.Add(1)
+		go func() {
+			defer n.workers.Done()
+			n.discover(n.ctx, discoveryConn)
+		}()
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			n.Stop()
+		case <-n.stopped:
+		}
+	}()
+
+	return nil
+}
+
+// Stop drains in-flight requests, stops syncing and closes the state. It is safe to call more than once
+func (n *Node) Stop() error {
+	n.stopOnce.Do(func() {
+		defer close(n.stopped)
+
+		if n.server == nil {
+			return
+		}
 
+		fmt.Println("Shutting down, draining in-flight requests...")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+
+		err := n.server.Shutdown(shutdownCtx)
+
+		n.stopSync()
+		<-n.syncDone
+		n.workers.Wait()
+		n.closeTCP()
+
+		saveErr := n.savePeers()
+		if err == nil {
+			err = saveErr
+		}
+
+		closeErr := n.state.Close()
+		if err == nil {
+			err = closeErr
+		}
+
+		n.stopErr = err
+
+		fmt.Println("Node stopped")
+	})
+
+	return n.stopErr
+}
+
+// Addr is the ip:port the node announces to its peers. Once started, it holds the port actually bound
+func (n *Node) Addr() string {
+	return hostPort(n.ip, n.port)
+}
+
+// Handler serves the HTTP API of the node, e.g. through httptest. The node must be started first
+func (n *Node) Handler() http.Handler {
+	return n.mux
+}
+
+func (n *Node) registerRoutes() {
 	// GET endpoint to get the balances of everyone on the network
-	http.HandleFunc("/balances/list", func(w http.ResponseWriter, r *http.Request) {
-		listBalancesHandler(w, r, state)
+	n.handle(endpointBalancesList, func(w http.ResponseWriter, r *http.Request) {
+		listBalancesHandler(w, r, n.state)
 	})
 
 	// POST endpoint to add new transactions to the ledger
-	http.HandleFunc("/tx/add", func(w http.ResponseWriter, r *http.Request) {
-		txAddHandler(w, r, state)
+	n.handle(endpointTxAdd, func(w http.ResponseWriter, r *http.Request) {
+		txAddHandler(w, r, n)
+	})
+
+	// POST endpoint to add a batch of transactions to the ledger, all in one block or none at all
+	n.handle(endpointTxBatch, func(w http.ResponseWriter, r *http.Request) {
+		txBatchHandler(w, r, n.state)
+	})
+
+	// POST endpoint to dry-run a batch of transactions against the current state
+	n.handle(endpointTxSimulate, func(w http.ResponseWriter, r *http.Request) {
+		txSimulateHandler(w, r, n.state)
+	})
+
+	// POST endpoint to add a transaction to the mempool, gossiped to the network until a node commits it
+	n.handle(endpointMempoolAdd, func(w http.ResponseWriter, r *http.Request) {
+		mempoolAddHandler(w, r, n)
+	})
+
+	// GET endpoint listing the pending transactions
+	n.handle(endpointMempoolList, func(w http.ResponseWriter, r *http.Request) {
+		mempoolListHandler(w, r, n)
+	})
+
+	// POST endpoint to commit the pending transactions in a new block
+	n.handle(endpointMempoolCommit, func(w http.ResponseWriter, r *http.Request) {
+		mempoolCommitHandler(w, r, n)
 	})
 
 	//GET endpoint to get the status of the node
-	http.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
+	n.handle(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(w, r, n)
 	})
 
-	http.HandleFunc(endpointSync, func(w http.ResponseWriter, r *http.Request) {
+	// GET endpoint serving whole blocks to the nodes which don't sync headers first yet
+	n.handle(endpointSync, func(w http.ResponseWriter, r *http.Request) {
 		syncHandler(w, r, n)
 	})
 
-	http.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
+	// GET endpoints for peers to download the headers of the chain, then the blocks of the headers they verified
+	n.handle(endpointHeaders, func(w http.ResponseWriter, r *http.Request) {
+		headersHandler(w, r, n)
+	})
+
+	n.handle(endpointBlocks, func(w http.ResponseWriter, r *http.Request) {
+		blocksHandler(w, r, n)
+	})
+
+	// POST endpoint running a sync round right away, reporting how it went with every peer
+	n.handle(endpointSyncNow, func(w http.ResponseWriter, r *http.Request) {
+		syncNowHandler(w, r, n)
+	})
+
+	// POST endpoint for nodes to join this one, telling who they are and which protocol they speak
+	n.handle(endpointHandshake, func(w http.ResponseWriter, r *http.Request) {
+		handshakeHandler(w, r, n)
+	})
+
+	// GET endpoint older nodes join through, answered with the reason why they can't
+	n.handle(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
 		addPeerHandler(w, r, n)
 	})
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", n.port), nil)
+	// POST endpoint for peers to push the blocks they commit
+	n.handle(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+
+	// POST endpoint for peers to gossip the transactions added to their mempool
+	n.handle(endpointTx, func(w http.ResponseWriter, r *http.Request) {
+		txAnnounceHandler(w, r, n)
+	})
+
+	// GET endpoint listing the known peers with their score and ban status
+	n.handle(endpointPeers, func(w http.ResponseWriter, r *http.Request) {
+		peersHandler(w, r, n)
+	})
+
+	// POST endpoint serving the JSON-RPC 2.0 interface
+	n.handle(endpointRPC, func(w http.ResponseWriter, r *http.Request) {
+		rpcHandler(w, r, n)
+	})
+
+	// GET endpoint exposing the node metrics in the Prometheus text format
+	n.handle(endpointMetrics, func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(w, r, n)
+	})
+
+	// GET endpoints for load balancers: is the process alive, and is it in sync enough to serve queries
+	n.handle(endpointHealthz, func(w http.ResponseWriter, r *http.Request) {
+		healthzHandler(w, r, n)
+	})
+
+	n.handle(endpointReadyz, func(w http.ResponseWriter, r *http.Request) {
+		readyzHandler(w, r, n)
+	})
+
+	// GET endpoint serving the web wallet and explorer, /ui being redirected to it
+	n.handle(endpointUI, uiHandler())
+}
+
+// handle registers handler under route, guarded by the route's limits and auth policy and instrumented for metrics
+func (n *Node) handle(route string, handler http.HandlerFunc) {
+	n.mux.HandleFunc(route, n.instrument(route, n.allowCORS(n.limit(route, n.authenticate(route, handler)))))
 }
 
+// AddPeer adds a peer, or marks a known one as connected, keeping its history, score and ban. The peer is never
+// made a bootstrap one, which only the configuration of the node does, see WithBootstrap and WithSeeds
 func (n *Node) AddPeer(peer PeerNode) {
+	peer.IsBootstrap = false
+	n.addPeer(peer)
+}
+
+// addBootstrapPeer adds a peer of the configuration of the node, marking it as bootstrap even if it was known
+func (n *Node) addBootstrapPeer(peer PeerNode) {
+	peer.IsBootstrap = true
+	n.addPeer(peer)
+}
+
+func (n *Node) addPeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	known, ok := n.knownPeers[peer.TcpAddress()]
+	if ok {
+		known.IsBootstrap = known.IsBootstrap || peer.IsBootstrap
+		known.connected = known.connected || peer.connected
+		known.authenticated = known.authenticated || peer.authenticated
+		n.knownPeers[peer.TcpAddress()] = known
+		return
+	}
+
+	if peer.AddedAt == 0 {
+		peer.AddedAt = uint64(time.Now().Unix())
+	}
+
 	n.knownPeers[peer.TcpAddress()] = peer
 }
 
 func (n *Node) RemovePeer(peer PeerNode) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
 	delete(n.knownPeers, peer.TcpAddress())
+	n.forgetPeerMetrics(peer.TcpAddress())
+}
+
+// KnownPeers returns a copy of the known peers, keyed by their TCP address
+func (n *Node) KnownPeers() map[string]PeerNode {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	knownPeers := make(map[string]PeerNode, len(n.knownPeers))
+	for tcpAddress, peer := range n.knownPeers {
+		knownPeers[tcpAddress] = peer
+	}
+
+	return knownPeers
+}
+
+func (n *Node) knownPeer(tcpAddress string) (PeerNode, bool) {
+	n.peersMu.RLock()
+	defer n.peersMu.RUnlock()
+
+	peer, ok := n.knownPeers[tcpAddress]
+
+	return peer, ok
 }
 
 func writeRes(w http.ResponseWriter, content interface{}) {
+	writeResCode(w, content, http.StatusOK)
+}
+
+func writeResCode(w http.ResponseWriter, content interface{}, code int) {
 	contentJson, err := json.Marshal(content)
 	if err != nil {
 		writeErrRes(w, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(code)
 	w.Write(contentJson)
 }
 
 func writeErrRes(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		code = statusErr.code
+	}
+
+	writeErrResCode(w, err, code)
+}
+
+func writeErrResCode(w http.ResponseWriter, err error, code int) {
 	jsonErrRes, _ := json.Marshal(ErrRes{Error: err.Error()})
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(code)
 	w.Write(jsonErrRes)
 }
 
 func readReq(r *http.Request, reqBody interface{}) error {
 	reqBodyJson, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		return fmt.Errorf("unable to read request body %s", err.Error())
+		return fmt.Errorf("unable to read request body %w", err)
 	}
 	defer r.Body.Close()
 
@@ -147,12 +727,38 @@ func readReq(r *http.Request, reqBody interface{}) error {
 	return nil
 }
 
+// peerClient creates a client to query peer through the node's shared http.Client.
+// The credentials of the node are only presented to the trusted peers
+func (n *Node) peerClient(peer PeerNode) *client.Client {
+	opts := []client.Option{
+		client.WithHTTPClient(n.httpClient),
+		client.WithTimeout(n.syncConfig.RequestTimeout),
+	}
+
+	if n.isTrustedPeer(peer) {
+		opts = append(opts, client.WithToken(n.auth.PeerToken), client.WithHMACSecret(n.auth.HMACSecret))
+	}
+
+	return client.New(fmt.Sprintf("%s://%s", n.peerScheme(), peer.TcpAddress()), opts...)
+}
+
+// isTrustedPeer tells whether the node presents its credentials to peer: the bootstrap and seed peers it was
+// configured with, and the peers which authenticated when they joined it. The peers learned from other peers
+// or discovered on the LAN are sent none until they join this node with valid credentials
+func (n *Node) isTrustedPeer(peer PeerNode) bool {
+	if known, ok := n.knownPeer(peer.TcpAddress()); ok {
+		peer = known
+	}
+
+	return peer.IsBootstrap || peer.authenticated
+}
+
 func (n *Node) IsKnownPeer(peer PeerNode) bool {
 	if peer.IP == n.ip && peer.Port == n.port {
 		return true
 	}
 
-	_, isKnownPeer := n.knownPeers[peer.TcpAddress()]
+	_, isKnownPeer := n.knownPeer(peer.TcpAddress())
 
 	return isKnownPeer
 }
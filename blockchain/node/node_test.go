@@ -0,0 +1,359 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// newTestDataDir copies the committed database into a temporary data dir, so tests never write into it
+func newTestDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	dbDir := filepath.Join(dataDir, "database")
+
+	err := os.Mkdir(dbDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir("../database")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		content, err := ioutil.ReadFile(filepath.Join("../database", f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dbDir, f.Name()), content, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dataDir
+}
+
+// startTestNode starts a node on a free port, stopped when the test ends
+func startTestNode(t *testing.T, opts ...Option) *Node {
+	t.Helper()
+
+	return startTestNodeAt(t, newTestDataDir(t), opts...)
+}
+
+// startTestNodeAt starts a node of dataDir, which may be the data dir of a node stopped before
+func startTestNodeAt(t *testing.T, dataDir string, opts ...Option) *Node {
+	t.Helper()
+
+	n := New(dataDir, append([]Option{WithPort(0), WithLimits(Limits{})}, opts...)...)
+
+	err := n.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		err := n.Stop()
+		if err != nil {
+			t.Errorf("unable to stop the node. %s", err)
+		}
+	})
+
+	return n
+}
+
+func testPeer(t *testing.T, n *Node) PeerNode {
+	t.Helper()
+
+	ip, rawPort, err := net.SplitHostPort(n.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := strconv.ParseUint(rawPort, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPeerNode(ip, port, true, false)
+}
+
+func testClient(n *Node) *client.Client {
+	return client.New("http://" + n.Addr())
+}
+
+func TestConcurrentTxsAndMempool(t *testing.T) {
+	n := startTestNode(t)
+	c := testClient(n)
+	ctx := context.Background()
+
+	const workers = 8
+	const txsPerWorker = 10
+
+	before := n.state.Balances()[database.NewAccount("babayaga")]
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*workers*txsPerWorker)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < txsPerWorker; i++ {
+				_, err := c.AddTx(ctx, TxAddReq{From: "andrej", To: "babayaga", Value: 1, Data: fmt.Sprintf("direct-%d-%d", w, i)})
+				if err != nil {
+					errs <- fmt.Errorf("/tx/add: %s", err)
+				}
+
+				_, err = c.AddPendingTx(ctx, TxAddReq{From: "andrej", To: "babayaga", Value: 1, Data: fmt.Sprintf("pending-%d-%d", w, i)})
+				if err != nil {
+					errs <- fmt.Errorf("/mempool/add: %s", err)
+				}
+
+				_, err = c.Mempool(ctx)
+				if err != nil {
+					errs <- fmt.Errorf("/mempool/list: %s", err)
+				}
+
+				// the mempool may have just been committed by another worker
+				_, err = c.CommitMempool(ctx)
+				var apiErr *client.APIError
+				if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest) {
+					errs <- fmt.Errorf("/mempool/commit: %s", err)
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n.state.MempoolSize() > 0 {
+		_, err := c.CommitMempool(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// every tx, direct or pending, is committed exactly once
+	after := n.state.Balances()[database.NewAccount("babayaga")]
+	if want := before + 2*workers*txsPerWorker; after != want {
+		t.Errorf("babayaga has %d TBB, want %d", after, want)
+	}
+}
+
+func TestSyncNowWhileTxsAreAdded(t *testing.T) {
+	a := startTestNode(t)
+	b := startTestNode(t, WithBootstrap(testPeer(t, a)))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		c := testClient(a)
+		for i := 0; i < 30; i++ {
+			_, err := c.AddTx(ctx, TxAddReq{From: "andrej", To: "caesar", Value: 1, Data: fmt.Sprintf("tx-%d", i)})
+			if err != nil {
+				t.Errorf("/tx/add: %s", err)
+			}
+		}
+	}()
+
+	for _, n := range []*Node{a, b} {
+		wg.Add(1)
+		go func(n *Node) {
+			defer wg.Done()
+
+			for i := 0; i < 5; i++ {
+				_, err := n.SyncNow(ctx)
+				if err != nil {
+					t.Errorf("SyncNow: %s", err)
+				}
+			}
+		}(n)
+	}
+
+	wg.Wait()
+
+	// a last round picks up the blocks added after the previous ones
+	deadline := time.Now().Add(10 * time.Second)
+	for b.state.LatestBlockHash() != a.state.LatestBlockHash() && time.Now().Before(deadline) {
+		_, err := b.SyncNow(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if b.state.LatestBlockHash() != a.state.LatestBlockHash() {
+		t.Fatalf("b is at block %d, a at block %d", b.state.LatestBlock().Header.Number, a.state.LatestBlock().Header.Number)
+	}
+}
+
+func TestGossipedPeersAreNeverTrusted(t *testing.T) {
+	claimed := NewPeerNode("127.0.0.1", 1, true, false)
+
+	a := startTestNode(t, WithBootstrap(claimed))
+	b := startTestNode(t, WithBootstrap(testPeer(t, a)))
+
+	_, err := b.SyncNow(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer, ok := b.knownPeer(claimed.TcpAddress())
+	if !ok {
+		t.Fatalf("b didn't learn about %s from a", claimed.TcpAddress())
+	}
+
+	if peer.IsBootstrap || b.isTrustedPeer(peer) {
+		t.Errorf("b trusts %s because a lists it as a bootstrap peer", claimed.TcpAddress())
+	}
+}
+
+func TestAddPeerNeverMakesBootstrapPeers(t *testing.T) {
+	n := New(t.TempDir())
+	peer := NewPeerNode("127.0.0.1", 1, false, false)
+
+	n.AddPeer(peer)
+	n.AddPeer(NewPeerNode(peer.IP, peer.Port, true, true))
+	n.AddPeer(NewPeerNode("127.0.0.1", 2, true, false))
+
+	for _, known := range n.KnownPeers() {
+		if known.IsBootstrap {
+			t.Errorf("AddPeer made %s a bootstrap peer", known.TcpAddress())
+		}
+	}
+
+	n.addBootstrapPeer(peer)
+
+	known, _ := n.knownPeer(peer.TcpAddress())
+	if !known.IsBootstrap {
+		t.Errorf("the configured peer %s isn't a bootstrap peer", peer.TcpAddress())
+	}
+}
+
+func TestTxAddIsGossiped(t *testing.T) {
+	a := startTestNode(t)
+	b := startTestNode(t, WithBootstrap(testPeer(t, a)))
+	ctx := context.Background()
+
+	// b joins a, which then knows b as a connected peer to gossip to
+	_, err := b.SyncNow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := testClient(a).AddTx(ctx, TxAddReq{From: "andrej", To: "babayaga", Value: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := a.state.LatestBlock().TXs[0]
+	txHash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockHash, ok := a.state.CommittedTxBlock(txHash)
+	if !ok || blockHash != res.Hash {
+		t.Fatalf("TX %x isn't committed by block %x", txHash, res.Hash)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, seen := b.seenTxs.origin(txHash); seen {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("TX %x added to a wasn't gossiped to b", txHash)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIdenticalTransfers(t *testing.T) {
+	n := startTestNode(t)
+	c := testClient(n)
+	ctx := context.Background()
+
+	before := n.state.Balances()[database.NewAccount("babayaga")]
+
+	for i := 0; i < 3; i++ {
+		_, err := c.AddTx(ctx, TxAddReq{From: "andrej", To: "babayaga", Value: 1})
+		if err != nil {
+			t.Fatalf("transfer %d: %s", i, err)
+		}
+
+		_, err = c.AddPendingTx(ctx, TxAddReq{From: "andrej", To: "babayaga", Value: 1})
+		if err != nil {
+			t.Fatalf("pending transfer %d: %s", i, err)
+		}
+	}
+
+	_, err := c.CommitMempool(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after := n.state.Balances()[database.NewAccount("babayaga")]; after != before+6 {
+		t.Errorf("babayaga has %d TBB, want %d", after, before+6)
+	}
+}
+
+func TestCommittedTxsAreBoundedByAge(t *testing.T) {
+	n := startTestNode(t)
+
+	// the committed blocks hold transactions older than TxMaxAge, which are not remembered
+	for _, tx := range n.state.LatestBlock().TXs {
+		txHash, err := tx.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := n.state.CommittedTxBlock(txHash); ok {
+			t.Errorf("the expired TX %x is remembered as committed", txHash)
+		}
+	}
+
+	expired := database.NewTx("andrej", "babayaga", 1, "")
+	expired.Time -= uint64(2 * database.TxMaxAge)
+
+	_, err := n.addPendingTx(expired, "")
+	if !errors.Is(err, database.ErrTxExpired) {
+		t.Errorf("the expired TX was added to the mempool, err %v", err)
+	}
+
+	future := database.NewTx("andrej", "babayaga", 1, "")
+	future.Time += uint64(2 * database.TxMaxAge)
+
+	_, err = n.addPendingTx(future, "")
+	if !errors.Is(err, database.ErrTxExpired) {
+		t.Errorf("the TX from the future was added to the mempool, err %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Peers neither seen nor added for longer are forgotten, unless they are bootstrap peers
+const DefaultPeerMaxAge = 7 * 24 * time.Hour
+
+const peersFileName = "peers.json"
+
+// peersFile is the content of <datadir>/peers.json
+type peersFile struct {
+	Peers []PeerNode `json:"peers"`
+}
+
+// WithPeerMaxAge sets how long a peer which doesn't answer is remembered, 0 to never forget peers
+func WithPeerMaxAge(maxAge time.Duration) Option {
+	return func(n *Node) {
+		n.peerMaxAge = maxAge
+	}
+}
+
+func getPeersFilePath(dataDir string) string {
+	return filepath.Join(dataDir, peersFileName)
+}
+
+// loadPeers reads the peers known before the last restart, with their history and bans
+func (n *Node) loadPeers() error {
+	peersJson, err := ioutil.ReadFile(getPeersFilePath(n.dataDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	stored := peersFile{}
+	err = json.Unmarshal(peersJson, &stored)
+	if err != nil {
+		return fmt.Errorf("unable to read '%s'. %s", getPeersFilePath(n.dataDir), err.Error())
+	}
+
+	// only the configuration tells which peers are bootstrap ones, AddPeer drops the stored flag which may be outdated
+	for _, peer := range stored.Peers {
+		n.AddPeer(peer)
+	}
+
+	return nil
+}
+
+// savePeers writes the known peers to a temporary file first, so a crash never leaves a truncated peers.json
+func (n *Node) savePeers() error {
+	stored := peersFile{Peers: make([]PeerNode, 0)}
+	for _, peer := range n.KnownPeers() {
+		stored.Peers = append(stored.Peers, peer)
+	}
+
+	sort.Slice(stored.Peers, func(i, j int) bool {
+		return stored.Peers[i].TcpAddress() < stored.Peers[j].TcpAddress()
+	})
+
+	peersJson, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := getPeersFilePath(n.dataDir)
+	tmpPath := path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, peersJson, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// prunePeers forgets the peers not seen, nor added if never seen, within the max age
+func (n *Node) prunePeers(now time.Time) {
+	if n.peerMaxAge <= 0 {
+		return
+	}
+
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	for tcpAddress, peer := range n.knownPeers {
+		if peer.IsBootstrap {
+			continue
+		}
+
+		lastActive := peer.LastSeen
+		if lastActive < peer.AddedAt {
+			lastActive = peer.AddedAt
+		}
+
+		if now.Sub(time.Unix(int64(lastActive), 0)) > n.peerMaxAge {
+			fmt.Printf("Peer '%s' was not seen for too long, it was removed from KnownPeers\n", tcpAddress)
+			delete(n.knownPeers, tcpAddress)
+			n.forgetPeerMetrics(tcpAddress)
+		}
+	}
+}
+
+// recordPeerSeen notes that the peer answered with its latest block number, even if syncing with it fails afterwards
+func (n *Node) recordPeerSeen(peer PeerNode, height uint64) {
+	n.updatePeer(peer, func(p *PeerNode) {
+		p.LastSeen = uint64(time.Now().Unix())
+		p.Height = height
+	})
+}
+
+func (n *Node) updatePeer(peer PeerNode, update func(p *PeerNode)) {
+	n.peersMu.Lock()
+	defer n.peersMu.Unlock()
+
+	known, ok := n.knownPeers[peer.TcpAddress()]
+	if !ok {
+		return
+	}
+
+	update(&known)
+	n.knownPeers[peer.TcpAddress()] = known
+}
@@ -0,0 +1,196 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// How long a peer is given to accept an announced block or tx, a slow peer still gets blocks on its next sync
+const announceTimeout = 2 * time.Second
+
+// Blocks committed faster than they are announced are left to the sync loop past this many
+const blockAnnounceQueueSize = 64
+
+const seenBlocksCapacity = 1024
+
+// blockHandler imports a block announced by a peer, which this node announces to its own peers in turn
+func blockHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	req := BlockAnnounceReq{}
+	err := readReq(r, &req)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	res, code := node.receiveBlock(req, clientIP(r))
+	writeResCode(w, res, code)
+}
+
+// receiveBlock imports an announced block. ip is the address the announcement came from, which identifies the
+// peer penalised for an invalid block: req.From is only a claim of the sender
+func (n *Node) receiveBlock(req BlockAnnounceReq, ip string) (AnnounceRes, int) {
+	block := req.Block.Value
+
+	hash, err := block.Hash()
+	if err != nil || hash != req.Block.Key {
+		err = &database.InvalidBlockError{Number: block.Header.Number, Err: fmt.Errorf("block hash doesn't match its content")}
+		n.penaliseAnnouncer(ip, err)
+		return AnnounceRes{Error: err.Error()}, http.StatusUnprocessableEntity
+	}
+
+	// the block is marked as seen up front so its announcement, once imported, skips the peer it came from.
+	// It is forgotten unless imported or already known, to be handled again when announced after a catch-up
+	if !n.seenBlocks.add(hash, req.From) {
+		return AnnounceRes{Known: true}, http.StatusOK
+	}
+
+	res, code := n.importAnnouncedBlock(block, req.From, ip)
+	if !res.Accepted && !res.Known {
+		n.seenBlocks.forget(hash)
+	}
+
+	return res, code
+}
+
+// importAnnouncedBlock adds block to the state, unless it is already known or doesn't extend the latest block
+func (n *Node) importAnnouncedBlock(block database.Block, from string, ip string) (AnnounceRes, int) {
+	if n.hasBlock(block.Header.Number) {
+		return AnnounceRes{Known: true}, http.StatusOK
+	}
+
+	next := n.state.NextBlockNumber()
+	if block.Header.Number > next {
+		err := fmt.Errorf("block %d doesn't follow the latest block, block %d is expected. It is left to the next sync", block.Header.Number, next)
+		return AnnounceRes{Error: err.Error()}, http.StatusConflict
+	}
+
+	_, err := n.state.AddBlock(block)
+
+	var invalidBlockErr *database.InvalidBlockError
+	if errors.As(err, &invalidBlockErr) {
+		// another peer may have announced a block of the same number first
+		if n.hasBlock(block.Header.Number) {
+			return AnnounceRes{Known: true}, http.StatusOK
+		}
+
+		// a block of another fork is well-formed, the sync settles which chain wins
+		if block.Header.Parent != n.state.LatestBlockHash() {
+			err = fmt.Errorf("block %d doesn't extend the latest block %x. It is left to the next sync", block.Header.Number, n.state.LatestBlockHash())
+			return AnnounceRes{Error: err.Error()}, http.StatusConflict
+		}
+
+		n.penaliseAnnouncer(ip, err)
+		return AnnounceRes{Error: err.Error()}, http.StatusUnprocessableEntity
+	}
+	if err != nil {
+		return AnnounceRes{Error: err.Error()}, http.StatusInternalServerError
+	}
+
+	fmt.Printf("Imported block %d announced by Peer '%s'\n", block.Header.Number, from)
+
+	return AnnounceRes{Accepted: true}, http.StatusOK
+}
+
+// hasBlock tells whether a block of this number is already part of the local chain
+func (n *Node) hasBlock(number uint64) bool {
+	return !n.state.LatestBlockHash().IsEmpty() && number <= n.state.LatestBlock().Header.Number
+}
+
+// penaliseAnnouncer records the failure of the known peer at ip. Nodes sharing an IP can't be told apart,
+// none of them is penalised then
+func (n *Node) penaliseAnnouncer(ip string, err error) {
+	n.peersMu.RLock()
+	announcers := make([]PeerNode, 0, 1)
+	for _, peer := range n.knownPeers {
+		if sameIP(peer.IP, ip) {
+			announcers = append(announcers, peer)
+		}
+	}
+	n.peersMu.RUnlock()
+
+	if len(announcers) == 1 {
+		n.recordPeerFailure(announcers[0], err)
+	}
+}
+
+func sameIP(a string, b string) bool {
+	if a == b {
+		return true
+	}
+
+	ipA := net.ParseIP(a)
+	ipB := net.ParseIP(b)
+
+	return ipA != nil && ipB != nil && ipA.Equal(ipB)
+}
+
+// queueBlockAnnouncement is called by the state for each committed block, it must not block
+func (n *Node) queueBlockAnnouncement(b database.BlockFS) {
+	n.seenBlocks.add(b.Key, "")
+
+	select {
+	case n.blockAnnouncements <- b:
+	default:
+		fmt.Printf("WARNING: too many blocks to announce, block %d is left to the peers' sync\n", b.Value.Header.Number)
+	}
+}
+
+// propagate announces the committed blocks and the pending txs to the connected peers until ctx is done
+func (n *Node) propagate(ctx context.Context) {
+	for {
+		select {
+		case b := <-n.blockAnnouncements:
+			n.announceBlock(ctx, b)
+
+		case tx := <-n.txAnnouncements:
+			n.announceTx(ctx, tx)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *Node) announceBlock(ctx context.Context, b database.BlockFS) {
+	origin, _ := n.seenBlocks.origin(b.Key)
+	req := BlockAnnounceReq{From: n.Addr(), Block: b}
+
+	n.broadcast(ctx, origin, FeatureBlockPush, fmt.Sprintf("block %d", b.Value.Header.Number), func(ctx context.Context, peer Transport) error {
+		_, err := peer.AnnounceBlock(ctx, req)
+		return err
+	})
+}
+
+// broadcast calls announce with the transport of every connected peer supporting feature at once, except the one at origin
+func (n *Node) broadcast(ctx context.Context, origin string, feature string, what string, announce func(ctx context.Context, peer Transport) error) {
+	now := time.Now()
+
+	wg := sync.WaitGroup{}
+	for tcpAddress, peer := range n.KnownPeers() {
+		if !peer.connected || !peer.supports(feature) || peer.isBanned(now) || tcpAddress == origin || tcpAddress == n.Addr() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(peer PeerNode) {
+			defer wg.Done()
+
+			announceCtx, cancel := context.WithTimeout(ctx, announceTimeout)
+			defer cancel()
+
+			err := announce(announceCtx, n.transport(peer))
+			if err != nil {
+				fmt.Printf("ERROR: unable to announce %s to Peer '%s'. %s\n", what, peer.TcpAddress(), err)
+			}
+		}(peer)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+func testBlock(t *testing.T, parent database.Hash, number uint64) database.BlockFS {
+	t.Helper()
+
+	block := database.NewBlock(parent, number, uint64(time.Now().Unix()), []database.Tx{
+		database.NewTx("andrej", "babayaga", 1, ""),
+	})
+
+	hash, err := block.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return database.BlockFS{Key: hash, Value: block}
+}
+
+func TestBlockAheadIsImportedWhenAnnouncedAgain(t *testing.T) {
+	n := startTestNode(t)
+
+	next := testBlock(t, n.state.LatestBlockHash(), n.state.NextBlockNumber())
+	ahead := testBlock(t, next.Key, next.Value.Header.Number+1)
+
+	tests := []struct {
+		name  string
+		block database.BlockFS
+		code  int
+		res   AnnounceRes
+	}{
+		{name: "ahead of the latest block", block: ahead, code: http.StatusConflict},
+		{name: "next block", block: next, code: http.StatusOK, res: AnnounceRes{Accepted: true}},
+		{name: "ahead block announced again", block: ahead, code: http.StatusOK, res: AnnounceRes{Accepted: true}},
+		{name: "known block", block: ahead, code: http.StatusOK, res: AnnounceRes{Known: true}},
+	}
+
+	for _, test := range tests {
+		res, code := n.receiveBlock(BlockAnnounceReq{From: "127.0.0.1:1", Block: test.block}, "127.0.0.1")
+
+		if code != test.code || res.Accepted != test.res.Accepted || res.Known != test.res.Known {
+			t.Errorf("%s: got %d %+v, want %d %+v", test.name, code, res, test.code, test.res)
+		}
+	}
+
+	if n.state.LatestBlockHash() != ahead.Key {
+		t.Errorf("the latest block is %x, want %x", n.state.LatestBlockHash(), ahead.Key)
+	}
+}
+
+func TestSeenCache(t *testing.T) {
+	c := newSeenCache(2)
+	a := database.Hash{1}
+	b := database.Hash{2}
+	d := database.Hash{3}
+
+	if !c.add(a, "peer-a") || c.add(a, "peer-b") {
+		t.Fatal("a hash must be added once")
+	}
+
+	if origin, _ := c.origin(a); origin != "peer-a" {
+		t.Errorf("origin of a is %q, want peer-a", origin)
+	}
+
+	c.forget(a)
+	if !c.add(a, "peer-c") {
+		t.Fatal("a forgotten hash must be added again")
+	}
+
+	// the cache is full: b takes the stale slot of the forgotten a without dropping a, then d evicts a
+	c.add(b, "")
+	if _, seen := c.origin(a); !seen {
+		t.Error("a was dropped with its stale slot")
+	}
+
+	c.add(d, "")
+
+	tests := []struct {
+		hash database.Hash
+		seen bool
+	}{
+		{hash: a, seen: false},
+		{hash: b, seen: true},
+		{hash: d, seen: true},
+	}
+
+	for _, test := range tests {
+		if _, seen := c.origin(test.hash); seen != test.seen {
+			t.Errorf("hash %x seen %v, want %v", test.hash[:1], seen, test.seen)
+		}
+	}
+}
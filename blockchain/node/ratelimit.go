@@ -0,0 +1,227 @@
+package node
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultMaxBodyBytes = int64(1 << 20)
+const DefaultMaxSyncBlocks = 500
+const DefaultMaxSyncHeaders = 2000
+
+// Rate is a token bucket refilled with PerSecond tokens every second, holding at most Burst tokens
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// DefaultRouteRates limits how often a single IP can hit the routes that write or read a lot
+var DefaultRouteRates = map[string]Rate{
+	endpointTxAdd:      {PerSecond: 5, Burst: 10},
+	endpointTxBatch:    {PerSecond: 1, Burst: 5},
+	endpointTxSimulate: {PerSecond: 5, Burst: 10},
+	endpointSync:       {PerSecond: 1, Burst: 5},
+	endpointHeaders:    {PerSecond: 2, Burst: 10},
+	endpointBlocks:     {PerSecond: 10, Burst: 20},
+	endpointSyncNow:    {PerSecond: 1, Burst: 3},
+	endpointAddPeer:    {PerSecond: 1, Burst: 5},
+	endpointHandshake:  {PerSecond: 1, Burst: 5},
+	endpointBlock:      {PerSecond: 10, Burst: 50},
+	endpointTx:         {PerSecond: 50, Burst: 200},
+	endpointMempoolAdd: {PerSecond: 5, Burst: 10},
+	endpointRPC:        {PerSecond: 10, Burst: 20},
+}
+
+type Limits struct {
+	// Maximum size in bytes of a request body, 0 disables the limit
+	MaxBodyBytes int64
+
+	// Maximum number of blocks sent in a single /node/sync or /node/blocks response
+	MaxSyncBlocks int
+
+	// Maximum number of headers sent in a single /node/headers response
+	MaxSyncHeaders int
+
+	// Rate limits per client IP, per route. Routes without one are not limited
+	RouteRates map[string]Rate
+}
+
+func DefaultLimits() Limits {
+	rates := make(map[string]Rate)
+	for route, rate := range DefaultRouteRates {
+		rates[route] = rate
+	}
+
+	return Limits{
+		MaxBodyBytes:   DefaultMaxBodyBytes,
+		MaxSyncBlocks:  DefaultMaxSyncBlocks,
+		MaxSyncHeaders: DefaultMaxSyncHeaders,
+		RouteRates:     rates,
+	}
+}
+
+// ParseRate reads a "route=perSecond:burst" triple as given on the command line
+func ParseRate(raw string) (string, Rate, error) {
+	invalid := fmt.Errorf("invalid rate limit '%s', expected 'route=perSecond:burst'", raw)
+
+	parts := strings.SplitN(raw, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", Rate{}, invalid
+	}
+
+	rateParts := strings.SplitN(parts[1], ":", 2)
+	if len(rateParts) != 2 {
+		return "", Rate{}, invalid
+	}
+
+	perSecond, err := strconv.ParseFloat(rateParts[0], 64)
+	if err != nil || perSecond < 0 {
+		return "", Rate{}, invalid
+	}
+
+	burst, err := strconv.Atoi(rateParts[1])
+	if err != nil || burst < 1 {
+		return "", Rate{}, invalid
+	}
+
+	return parts[0], Rate{PerSecond: perSecond, Burst: burst}, nil
+}
+
+// statusError is an error answered with a specific HTTP status code by writeErrRes
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+var errBodyTooLarge = &statusError{code: http.StatusRequestEntityTooLarge, msg: "request body too large"}
+
+// limit rejects requests over the route's rate limit and caps the size of their body
+func (n *Node) limit(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rate, ok := n.limits.RouteRates[route]; ok {
+			retryAfter, allowed := n.rateLimiter.allow(route, clientIP(r), rate, time.Now())
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				writeErrResCode(w, fmt.Errorf("too many requests to '%s'", route), http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		if n.limits.MaxBodyBytes > 0 && r.Body != nil {
+			r.Body = &limitedBody{ReadCloser: r.Body, remaining: n.limits.MaxBodyBytes}
+		}
+
+		handler(w, r)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// limitedBody fails with errBodyTooLarge once more than remaining bytes are read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+
+	// read one byte over the limit to tell a body of exactly the limit from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	read, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(read)
+	if b.remaining < 0 {
+		return read + int(b.remaining), errBodyTooLarge
+	}
+
+	return read, err
+}
+
+// bucketIdleTTL is how long the bucket of a client which stopped sending requests is kept
+const bucketIdleTTL = 10 * time.Minute
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter holds a token bucket per route and client IP
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow takes a token from the bucket of ip on route, or reports how long until one is available
+func (l *rateLimiter) allow(route string, ip string, rate Rate, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	key := route + "|" + ip
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), lastSeen: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+now.Sub(b.lastSeen).Seconds()*rate.PerSecond)
+	b.lastSeen = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	if rate.PerSecond <= 0 {
+		return time.Hour, false
+	}
+
+	return time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second)), false
+}
+
+// sweep forgets the buckets of clients idle for long enough to have refilled them
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTTL {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > bucketIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
@@ -0,0 +1,208 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rate := Rate{PerSecond: 2, Burst: 3}
+	start := time.Now()
+
+	// every step happens after the given time since start, against the same bucket unless another ip is given
+	steps := []struct {
+		after      time.Duration
+		ip         string
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{after: 0, allowed: true},
+		{after: 0, allowed: true},
+		{after: 0, allowed: true},
+		{after: 0, retryAfter: 500 * time.Millisecond},
+		{after: 0, ip: "10.0.0.2", allowed: true},
+		{after: 250 * time.Millisecond, retryAfter: 250 * time.Millisecond},
+		{after: 500 * time.Millisecond, allowed: true},
+		{after: 500 * time.Millisecond, retryAfter: 500 * time.Millisecond},
+		{after: 10 * time.Second, allowed: true},
+		{after: 10 * time.Second, allowed: true},
+		{after: 10 * time.Second, allowed: true},
+		{after: 10 * time.Second, retryAfter: 500 * time.Millisecond},
+	}
+
+	l := newRateLimiter()
+	for i, step := range steps {
+		ip := step.ip
+		if ip == "" {
+			ip = "10.0.0.1"
+		}
+
+		retryAfter, allowed := l.allow(endpointTxAdd, ip, rate, start.Add(step.after))
+		if allowed != step.allowed {
+			t.Errorf("step %d: allowed %t, want %t", i, allowed, step.allowed)
+		}
+
+		if diff := retryAfter - step.retryAfter; diff > time.Millisecond || diff < -time.Millisecond {
+			t.Errorf("step %d: retry after %s, want %s", i, retryAfter, step.retryAfter)
+		}
+	}
+
+	_, allowed := l.allow(endpointTxBatch, "10.0.0.1", rate, start.Add(10*time.Second))
+	if !allowed {
+		t.Error("the bucket of a route was shared with another route")
+	}
+
+	l.allow(endpointTxAdd, "10.0.0.3", Rate{PerSecond: 0, Burst: 1}, start)
+	retryAfter, allowed := l.allow(endpointTxAdd, "10.0.0.3", Rate{PerSecond: 0, Burst: 1}, start.Add(time.Minute))
+	if allowed || retryAfter != time.Hour {
+		t.Errorf("a bucket never refilled allowed %t, retry after %s", allowed, retryAfter)
+	}
+}
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	rate := Rate{PerSecond: 1, Burst: 1}
+	start := time.Now()
+
+	l := newRateLimiter()
+	l.allow(endpointTxAdd, "10.0.0.1", rate, start)
+	l.allow(endpointTxAdd, "10.0.0.2", rate, start.Add(bucketIdleTTL))
+	l.allow(endpointTxAdd, "10.0.0.2", rate, start.Add(2*bucketIdleTTL))
+
+	if _, ok := l.buckets[endpointTxAdd+"|10.0.0.1"]; ok {
+		t.Error("the bucket of an idle client was kept")
+	}
+	if _, ok := l.buckets[endpointTxAdd+"|10.0.0.2"]; !ok {
+		t.Error("the bucket of an active client was forgotten")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		raw   string
+		route string
+		rate  Rate
+		err   bool
+	}{
+		{raw: "/tx/add=5:10", route: "/tx/add", rate: Rate{PerSecond: 5, Burst: 10}},
+		{raw: "/rpc=0.5:1", route: "/rpc", rate: Rate{PerSecond: 0.5, Burst: 1}},
+		{raw: "/rpc=0:1", route: "/rpc", rate: Rate{PerSecond: 0, Burst: 1}},
+		{raw: "/rpc", err: true},
+		{raw: "=5:10", err: true},
+		{raw: "/rpc=5", err: true},
+		{raw: "/rpc=-1:10", err: true},
+		{raw: "/rpc=5:0", err: true},
+		{raw: "/rpc=five:10", err: true},
+	}
+
+	for _, test := range tests {
+		route, rate, err := ParseRate(test.raw)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: parsed as %s=%+v", test.raw, route, rate)
+			}
+			continue
+		}
+
+		if err != nil || route != test.route || rate != test.rate {
+			t.Errorf("%s: parsed as %s=%+v %v, want %s=%+v", test.raw, route, rate, err, test.route, test.rate)
+		}
+	}
+}
+
+func TestLimitedBody(t *testing.T) {
+	const limit = 16
+
+	tests := []struct {
+		name    string
+		size    int
+		oneByte bool
+	}{
+		{name: "empty", size: 0},
+		{name: "under the limit", size: limit - 1},
+		{name: "at the limit", size: limit},
+		{name: "at the limit, a byte at a time", size: limit, oneByte: true},
+		{name: "a byte over the limit", size: limit + 1},
+		{name: "a byte over the limit, a byte at a time", size: limit + 1, oneByte: true},
+		{name: "far over the limit", size: 10 * limit},
+	}
+
+	for _, test := range tests {
+		body := bytes.Repeat([]byte("x"), test.size)
+
+		reader := ioutil.NopCloser(bytes.NewReader(body))
+		if test.oneByte {
+			reader = ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader(body)))
+		}
+
+		read, err := ioutil.ReadAll(&limitedBody{ReadCloser: reader, remaining: limit})
+
+		if test.size > limit {
+			if !errors.Is(err, errBodyTooLarge) {
+				t.Errorf("%s: failed with %v, want %v", test.name, err, errBodyTooLarge)
+			}
+			if len(read) > limit {
+				t.Errorf("%s: %d bytes were read past the limit of %d", test.name, len(read), limit)
+			}
+			continue
+		}
+
+		if err != nil || len(read) != test.size {
+			t.Errorf("%s: read %d bytes and %v, want the %d bytes of the body", test.name, len(read), err, test.size)
+		}
+	}
+}
+
+func TestLimitRejectsRequests(t *testing.T) {
+	const maxBody = 128
+
+	n := startTestNode(t, WithLimits(Limits{
+		MaxBodyBytes: maxBody,
+		RouteRates:   map[string]Rate{endpointTxSimulate: {PerSecond: 0, Burst: 2}},
+	}))
+
+	post := func(route string, body string) *http.Response {
+		t.Helper()
+
+		res, err := http.Post("http://"+n.Addr()+route, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		return res
+	}
+
+	tx := `{"from":"andrej","to":"babayaga","value":1}`
+	batch := `{"txs":[` + tx + `]}`
+	atLimit := batch + strings.Repeat(" ", maxBody-len(batch))
+
+	tests := []struct {
+		name   string
+		route  string
+		body   string
+		status int
+	}{
+		{name: "body at the limit", route: endpointTxSimulate, body: atLimit, status: http.StatusOK},
+		{name: "body over the limit", route: endpointTxAdd, body: atLimit + " ", status: http.StatusRequestEntityTooLarge},
+		{name: "last request of the burst", route: endpointTxSimulate, body: batch, status: http.StatusOK},
+		{name: "request over the rate", route: endpointTxSimulate, body: batch, status: http.StatusTooManyRequests},
+		{name: "route without a rate", route: endpointTxAdd, body: tx, status: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		res := post(test.route, test.body)
+		if res.StatusCode != test.status {
+			t.Errorf("%s: answered %d, want %d", test.name, res.StatusCode, test.status)
+		}
+
+		if test.status == http.StatusTooManyRequests && res.Header.Get("Retry-After") != "3600" {
+			t.Errorf("%s: retry after %q, want 3600 seconds", test.name, res.Header.Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// JSON-RPC 2.0 interface exposing the same State and Node logic as the REST handlers
+// https://www.jsonrpc.org/specification
+const endpointRPC = client.EndpointRPC
+
+const rpcVersion = "2.0"
+
+const rpcMethodGetBlock = "chain_getBlock"
+const rpcMethodGetStatus = "chain_getStatus"
+const rpcMethodGetBalance = "state_getBalance"
+const rpcMethodTxSubmit = "tx_submit"
+const rpcMethodTxGet = "tx_get"
+const rpcMethodNetPeers = "net_peers"
+
+// error codes reserved by the JSON-RPC 2.0 spec
+const rpcErrParse = -32700
+const rpcErrInvalidRequest = -32600
+const rpcErrMethodNotFound = -32601
+const rpcErrInvalidParams = -32602
+const rpcErrInternal = -32603
+
+// implementation defined server errors
+const rpcErrNotFound = -32001
+const rpcErrUnauthorized = -32002
+
+type RPCReq = client.RPCReq
+type RPCRes = client.RPCRes
+type RPCError = client.RPCError
+
+type GetBlockParams struct {
+	Hash   *database.Hash `json:"hash,omitempty"`
+	Number *uint64        `json:"number,omitempty"`
+}
+
+type GetBalanceParams struct {
+	Account database.Account `json:"account"`
+}
+
+type GetBalanceRes struct {
+	Hash    database.Hash    `json:"block_hash"`
+	Account database.Account `json:"account"`
+	Balance uint             `json:"balance"`
+}
+
+type TxGetParams struct {
+	Hash database.Hash `json:"hash"`
+}
+
+type rpcMethod func(n *Node, params json.RawMessage) (interface{}, *RPCError)
+
+var rpcMethods = map[string]rpcMethod{
+	rpcMethodGetBlock:   rpcGetBlock,
+	rpcMethodGetStatus:  rpcGetStatus,
+	rpcMethodGetBalance: rpcGetBalance,
+	rpcMethodTxSubmit:   rpcTxSubmit,
+	rpcMethodTxGet:      rpcTxGet,
+	rpcMethodNetPeers:   rpcNetPeers,
+}
+
+func rpcHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be sent with POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, errBodyTooLarge) {
+		writeErrRes(w, err)
+		return
+	}
+	if err != nil {
+		writeRPCRes(w, rpcErrRes(nil, rpcErrParse, err.Error()))
+		return
+	}
+	defer r.Body.Close()
+
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		writeRPCRes(w, rpcErrRes(nil, rpcErrParse, "invalid JSON"))
+		return
+	}
+
+	// a batch is an array of requests, answered by an array of responses
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		err := json.Unmarshal(body, &batch)
+		if err != nil {
+			writeRPCRes(w, rpcErrRes(nil, rpcErrParse, err.Error()))
+			return
+		}
+
+		if len(batch) == 0 {
+			writeRPCRes(w, rpcErrRes(nil, rpcErrInvalidRequest, "empty batch"))
+			return
+		}
+
+		responses := make([]RPCRes, 0, len(batch))
+		for _, rawReq := range batch {
+			res, isNotification := node.handleRPC(rawReq, isAuthenticated(r))
+			if !isNotification {
+				responses = append(responses, res)
+			}
+		}
+
+		// a batch made only of notifications gets no response at all
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeRPCRes(w, responses)
+		return
+	}
+
+	res, isNotification := node.handleRPC(body, isAuthenticated(r))
+	if isNotification {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeRPCRes(w, res)
+}
+
+// handleRPC executes a single JSON-RPC request and reports whether it was a notification
+func (n *Node) handleRPC(rawReq json.RawMessage, authenticated bool) (RPCRes, bool) {
+	req := RPCReq{}
+	err := json.Unmarshal(rawReq, &req)
+	if err != nil {
+		return rpcErrRes(nil, rpcErrInvalidRequest, err.Error()), false
+	}
+
+	if req.JSONRPC != rpcVersion || req.Method == "" {
+		return rpcErrRes(req.ID, rpcErrInvalidRequest, "invalid JSON-RPC 2.0 request"), req.ID == nil
+	}
+
+	method, ok := rpcMethods[req.Method]
+	if !ok {
+		return rpcErrRes(req.ID, rpcErrMethodNotFound, fmt.Sprintf("method '%s' not found", req.Method)), req.ID == nil
+	}
+
+	if !authenticated && n.auth.rpcPolicy(req.Method) == PolicyAuthenticated {
+		return rpcErrRes(req.ID, rpcErrUnauthorized, fmt.Sprintf("method '%s' requires an API token or signature", req.Method)), req.ID == nil
+	}
+
+	result, rpcErr := method(n, req.Params)
+	if rpcErr != nil {
+		return RPCRes{JSONRPC: rpcVersion, Error: rpcErr, ID: rpcID(req.ID)}, req.ID == nil
+	}
+
+	return RPCRes{JSONRPC: rpcVersion, Result: result, ID: rpcID(req.ID)}, req.ID == nil
+}
+
+func rpcGetBlock(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	p := GetBlockParams{}
+	if rpcErr := readRPCParams(params, &p); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	var blockFs database.BlockFS
+	var found bool
+	var err error
+
+	switch {
+	case p.Hash != nil:
+		blockFs, found, err = database.GetBlockByHash(*p.Hash, n.dataDir)
+	case p.Number != nil:
+		blockFs, found, err = database.GetBlockByNumber(*p.Number, n.dataDir)
+	default:
+		return nil, &RPCError{Code: rpcErrInvalidParams, Message: "either 'hash' or 'number' is required"}
+	}
+
+	if err != nil {
+		return nil, &RPCError{Code: rpcErrInternal, Message: err.Error()}
+	}
+	if !found {
+		return nil, &RPCError{Code: rpcErrNotFound, Message: "block not found"}
+	}
+
+	return blockFs, nil
+}
+
+func rpcGetStatus(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	return n.status(), nil
+}
+
+func rpcGetBalance(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	p := GetBalanceParams{}
+	if rpcErr := readRPCParams(params, &p); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	if p.Account == "" {
+		return nil, &RPCError{Code: rpcErrInvalidParams, Message: "'account' is required"}
+	}
+
+	snapshot := n.state.Snapshot()
+
+	return GetBalanceRes{
+		Hash:    snapshot.LatestBlockHash,
+		Account: p.Account,
+		Balance: snapshot.Balances[p.Account],
+	}, nil
+}
+
+func rpcTxSubmit(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	req := TxAddReq{}
+	if rpcErr := readRPCParams(params, &req); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	hash, err := n.addTx(req)
+	if err != nil {
+		return nil, &RPCError{Code: rpcErrInternal, Message: err.Error()}
+	}
+
+	return TxAddRes{Hash: hash}, nil
+}
+
+func rpcTxGet(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	p := TxGetParams{}
+	if rpcErr := readRPCParams(params, &p); rpcErr != nil {
+		return nil, rpcErr
+	}
+
+	tx, found, err := database.GetTx(p.Hash, n.dataDir)
+	if err != nil {
+		return nil, &RPCError{Code: rpcErrInternal, Message: err.Error()}
+	}
+	if !found {
+		return nil, &RPCError{Code: rpcErrNotFound, Message: "transaction not found"}
+	}
+
+	return tx, nil
+}
+
+func rpcNetPeers(n *Node, params json.RawMessage) (interface{}, *RPCError) {
+	return n.status().KnownPeers, nil
+}
+
+func readRPCParams(params json.RawMessage, v interface{}) *RPCError {
+	if len(params) == 0 {
+		return nil
+	}
+
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return &RPCError{Code: rpcErrInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+func rpcErrRes(id json.RawMessage, code int, msg string) RPCRes {
+	return RPCRes{
+		JSONRPC: rpcVersion,
+		Error:   &RPCError{Code: code, Message: msg},
+		ID:      rpcID(id),
+	}
+}
+
+// the response id must be null when the request id could not be read
+func rpcID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+
+	return id
+}
+
+func writeRPCRes(w http.ResponseWriter, content interface{}) {
+	contentJson, err := json.Marshal(content)
+	if err != nil {
+		contentJson, _ = json.Marshal(rpcErrRes(nil, rpcErrInternal, err.Error()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(contentJson)
+}
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// rpcOutcome is the id of a response and its error code, 0 for a result
+type rpcOutcome struct {
+	id   string
+	code int
+}
+
+func TestRPCBatches(t *testing.T) {
+	n := startTestNode(t)
+
+	status := `{"jsonrpc":"2.0","method":"chain_getStatus","id":1}`
+	notification := `{"jsonrpc":"2.0","method":"chain_getStatus"}`
+
+	tests := []struct {
+		name      string
+		body      string
+		batch     bool
+		responses []rpcOutcome
+	}{
+		{name: "request", body: status, responses: []rpcOutcome{{id: "1"}}},
+		{name: "request with a null id", body: `{"jsonrpc":"2.0","method":"chain_getStatus","id":null}`, responses: []rpcOutcome{{id: "null"}}},
+		{name: "notification", body: notification},
+		{name: "notification of an unknown method", body: `{"jsonrpc":"2.0","method":"chain_nothing"}`},
+		{name: "invalid JSON", body: `{"jsonrpc":"2.0",`, responses: []rpcOutcome{{id: "null", code: rpcErrParse}}},
+		{name: "invalid JSON in a batch", body: `[` + status + `,`, responses: []rpcOutcome{{id: "null", code: rpcErrParse}}},
+		{name: "empty batch", body: ` [ ] `, responses: []rpcOutcome{{id: "null", code: rpcErrInvalidRequest}}},
+		{name: "batch of notifications", body: `[` + notification + `,` + notification + `]`, batch: true},
+		{
+			name:  "batch of invalid requests",
+			body:  `[1, "status"]`,
+			batch: true,
+			responses: []rpcOutcome{
+				{id: "null", code: rpcErrInvalidRequest},
+				{id: "null", code: rpcErrInvalidRequest},
+			},
+		},
+		{
+			name: "mixed batch",
+			body: `[` + strings.Join([]string{
+				status,
+				notification,
+				`{"jsonrpc":"2.0","method":"chain_nothing","id":"a"}`,
+				`{"jsonrpc":"1.0","method":"chain_getStatus","id":3}`,
+				`{"jsonrpc":"2.0","method":"state_getBalance","params":{},"id":4}`,
+				`{"jsonrpc":"2.0","method":"state_getBalance","params":{"account":"andrej"}}`,
+				`{"jsonrpc":"2.0","method":"chain_getBlock","params":{"number":0},"id":5}`,
+				`{"jsonrpc":"2.0","method":"tx_get","params":{"hash":"0000000000000000000000000000000000000000000000000000000000000000"},"id":6}`,
+			}, ",") + `]`,
+			batch: true,
+			responses: []rpcOutcome{
+				{id: "1"},
+				{id: `"a"`, code: rpcErrMethodNotFound},
+				{id: "3", code: rpcErrInvalidRequest},
+				{id: "4", code: rpcErrInvalidParams},
+				{id: "5"},
+				{id: "6", code: rpcErrNotFound},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		res, err := http.Post("http://"+n.Addr()+endpointRPC, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(test.responses) == 0 {
+			if res.StatusCode != http.StatusNoContent || len(body) != 0 {
+				t.Errorf("%s: answered %d %s, want no content", test.name, res.StatusCode, body)
+			}
+			continue
+		}
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: answered %d, want %d", test.name, res.StatusCode, http.StatusOK)
+			continue
+		}
+
+		// a batch is answered by an array even when it holds a single response, anything else by an object
+		responses := []RPCRes{}
+		if test.batch {
+			err = json.Unmarshal(body, &responses)
+		} else {
+			responses = append(responses, RPCRes{})
+			err = json.Unmarshal(body, &responses[0])
+		}
+		if err != nil {
+			t.Errorf("%s: unable to read the response %s. %s", test.name, body, err)
+			continue
+		}
+
+		if len(responses) != len(test.responses) {
+			t.Errorf("%s: got %d responses, want %d. %s", test.name, len(responses), len(test.responses), body)
+			continue
+		}
+
+		for i, want := range test.responses {
+			got := rpcOutcome{id: string(responses[i].ID)}
+			if responses[i].Error != nil {
+				got.code = responses[i].Error.Code
+			}
+
+			if got != want {
+				t.Errorf("%s: response %d is %+v, want %+v", test.name, i, got, want)
+			}
+			if responses[i].JSONRPC != rpcVersion {
+				t.Errorf("%s: response %d is of version %q", test.name, i, responses[i].JSONRPC)
+			}
+		}
+	}
+}
+
+func TestRPCRequiresPost(t *testing.T) {
+	res, err := http.Get("http://" + startTestNode(t).Addr() + endpointRPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("a GET was answered %d, allowing %q", res.StatusCode, res.Header.Get("Allow"))
+	}
+}
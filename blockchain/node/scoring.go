@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+const DefaultBanScore = -100
+const DefaultBanDuration = time.Hour
+const DefaultBackoffBase = time.Minute
+const DefaultBackoffMax = 30 * time.Minute
+
+// Score changes of a peer. Unreachable peers are backed off rather than penalised, they may just be restarting
+const scoreSuccess = 1
+const scoreMax = 100
+const scoreMalformedResponse = -20
+const scoreInvalidBlock = -50
+
+type PeerScoring struct {
+	// Peers whose score drops to BanScore or below are banned for BanDuration
+	BanScore    int
+	BanDuration time.Duration
+
+	// Unreachable peers are retried after BackoffBase, doubled on every failure in a row up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+func DefaultPeerScoring() PeerScoring {
+	return PeerScoring{
+		BanScore:    DefaultBanScore,
+		BanDuration: DefaultBanDuration,
+		BackoffBase: DefaultBackoffBase,
+		BackoffMax:  DefaultBackoffMax,
+	}
+}
+
+func WithPeerScoring(scoring PeerScoring) Option {
+	return func(n *Node) {
+		n.scoring = scoring
+	}
+}
+
+func (pn PeerNode) isBanned(now time.Time) bool {
+	return pn.BannedUntil > uint64(now.Unix())
+}
+
+// isBackedOff tells whether the peer failed recently enough to not be synced with yet
+func (pn PeerNode) isBackedOff(now time.Time) bool {
+	return pn.RetryAt > uint64(now.Unix())
+}
+
+// isBannedPeer tells whether the peer at tcpAddress is known and banned
+func (n *Node) isBannedPeer(tcpAddress string) bool {
+	peer, ok := n.knownPeer(tcpAddress)
+
+	return ok && peer.isBanned(time.Now())
+}
+
+// recordPeerSuccess rewards a peer that was fully synced with and clears its backoff
+func (n *Node) recordPeerSuccess(peer PeerNode) {
+	n.updatePeer(peer, func(p *PeerNode) {
+		p.Successes++
+		p.ConsecutiveFailures = 0
+		p.RetryAt = 0
+
+		if p.Score += scoreSuccess; p.Score > scoreMax {
+			p.Score = scoreMax
+		}
+	})
+}
+
+// recordPeerFailure penalises a peer that sent invalid blocks or malformed responses,
+// and backs off from a peer that couldn't be reached or failed to answer
+func (n *Node) recordPeerFailure(peer PeerNode, err error) {
+	// requests cancelled by the shutdown say nothing about the peer
+	if errors.Is(err, context.Canceled) && n.ctx != nil && n.ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+
+	n.updatePeer(peer, func(p *PeerNode) {
+		p.Failures++
+		p.ConsecutiveFailures++
+		p.connected = false
+
+		var invalidBlockErr *database.InvalidBlockError
+		var decodeErr *client.DecodeError
+		var handshakeErr *client.HandshakeError
+
+		switch {
+		case errors.As(err, &invalidBlockErr):
+			n.penalisePeer(p, scoreInvalidBlock, now)
+		case errors.As(err, &decodeErr):
+			n.penalisePeer(p, scoreMalformedResponse, now)
+		// an incompatible peer isn't misbehaving, but it won't become compatible before it is upgraded
+		case errors.As(err, &handshakeErr):
+			p.RetryAt = uint64(now.Add(n.scoring.BackoffMax).Unix())
+			fmt.Printf("Peer '%s' is incompatible, retrying in %s. %s\n", p.TcpAddress(), n.scoring.BackoffMax, handshakeErr.Reason)
+		default:
+			backoff := n.scoring.BackoffBase
+			for i := uint64(1); i < p.ConsecutiveFailures && backoff < n.scoring.BackoffMax; i++ {
+				backoff *= 2
+			}
+			if backoff > n.scoring.BackoffMax {
+				backoff = n.scoring.BackoffMax
+			}
+
+			p.RetryAt = uint64(now.Add(backoff).Unix())
+			fmt.Printf("Peer '%s' failed %d times in a row, retrying in %s\n", p.TcpAddress(), p.ConsecutiveFailures, backoff)
+		}
+	})
+}
+
+// penalisePeer lowers the score of p, and bans it once it reaches the ban score. Its score is reset after the ban
+func (n *Node) penalisePeer(p *PeerNode, penalty int, now time.Time) {
+	p.Score += penalty
+	if p.Score > n.scoring.BanScore {
+		return
+	}
+
+	p.Score = 0
+	p.Bans++
+	p.BannedUntil = uint64(now.Add(n.scoring.BanDuration).Unix())
+	n.forgetPeerMetrics(p.TcpAddress())
+	fmt.Printf("Peer '%s' was banned until %s\n", p.TcpAddress(), time.Unix(int64(p.BannedUntil), 0).Format(time.RFC3339))
+}
@@ -0,0 +1,133 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often the hostnames of seeds are resolved again, to follow their DNS records
+const DefaultSeedResolveInterval = 10 * time.Minute
+
+// Seed is a bootstrap peer given as ip:port or host:port. Hostnames are resolved into one peer per address
+type Seed struct {
+	Host string
+	Port uint64
+}
+
+func (s Seed) String() string {
+	return net.JoinHostPort(s.Host, strconv.FormatUint(s.Port, 10))
+}
+
+func (s Seed) isIP() bool {
+	return net.ParseIP(s.Host) != nil
+}
+
+func ParseSeed(raw string) (Seed, error) {
+	host, rawPort, err := net.SplitHostPort(strings.TrimSpace(raw))
+	if err != nil || host == "" {
+		return Seed{}, fmt.Errorf("invalid seed '%s', expected 'ip:port' or 'host:port'", raw)
+	}
+
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil || port == 0 {
+		return Seed{}, fmt.Errorf("invalid port in seed '%s'", raw)
+	}
+
+	return Seed{Host: host, Port: port}, nil
+}
+
+// LoadSeedsFile reads a seed per line, ignoring blank lines and '#' comments
+func LoadSeedsFile(path string) ([]Seed, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seeds := make([]Seed, 0)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		if i := strings.Index(raw, "#"); i >= 0 {
+			raw = raw[:i]
+		}
+
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+
+		seed, err := ParseSeed(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err.Error())
+		}
+
+		seeds = append(seeds, seed)
+	}
+
+	return seeds, scanner.Err()
+}
+
+// WithSeeds adds bootstrap peers. The ones given by hostname are resolved when the node starts syncing
+func WithSeeds(seeds ...Seed) Option {
+	return func(n *Node) {
+		for _, seed := range seeds {
+			if seed.isIP() {
+				n.addBootstrapPeer(NewPeerNode(seed.Host, seed.Port, true, false))
+				continue
+			}
+
+			n.seeds = append(n.seeds, seed)
+		}
+	}
+}
+
+func WithSeedResolveInterval(interval time.Duration) Option {
+	return func(n *Node) {
+		n.seedResolveInterval = interval
+	}
+}
+
+// resolveSeeds adds the current addresses of the hostname seeds as bootstrap peers.
+// Addresses a seed no longer resolves to are kept as regular peers, to be pruned once they stop answering
+func (n *Node) resolveSeeds(ctx context.Context) {
+	n.seedsResolvedAt = time.Now()
+
+	for _, seed := range n.seeds {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, seed.Host)
+		if err != nil {
+			fmt.Printf("ERROR: unable to resolve seed '%s'. %s\n", seed, err)
+			continue
+		}
+
+		resolved := make(map[string]PeerNode)
+		for _, ip := range ips {
+			peer := NewPeerNode(ip.IP.String(), seed.Port, true, false)
+			if peer.IP == n.ip && peer.Port == n.port {
+				continue
+			}
+
+			if !n.IsKnownPeer(peer) {
+				fmt.Printf("Seed '%s' resolved to Peer %s\n", seed, peer.TcpAddress())
+			}
+
+			n.addBootstrapPeer(peer)
+			resolved[peer.TcpAddress()] = peer
+		}
+
+		for tcpAddress, peer := range n.seedPeers[seed.String()] {
+			if _, ok := resolved[tcpAddress]; !ok {
+				n.updatePeer(peer, func(p *PeerNode) {
+					p.IsBootstrap = false
+				})
+			}
+		}
+
+		n.seedPeers[seed.String()] = resolved
+	}
+}
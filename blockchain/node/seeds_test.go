@@ -0,0 +1,50 @@
+package node
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSeedAddresses(t *testing.T) {
+	tests := []struct {
+		raw  string
+		addr string
+	}{
+		{raw: "127.0.0.1:8080", addr: "127.0.0.1:8080"},
+		{raw: "[::1]:8080", addr: "[::1]:8080"},
+		{raw: " [2001:db8::7]:9000 ", addr: "[2001:db8::7]:9000"},
+	}
+
+	for _, test := range tests {
+		seed, err := ParseSeed(test.raw)
+		if err != nil {
+			t.Fatalf("ParseSeed(%q): %s", test.raw, err)
+		}
+
+		n := New(t.TempDir(), WithSeeds(seed))
+
+		peer, ok := n.knownPeer(test.addr)
+		if !ok {
+			t.Fatalf("seed %q isn't known as %s, known peers: %v", test.raw, test.addr, n.KnownPeers())
+		}
+
+		// the address of the peer must be one to dial
+		host, _, err := net.SplitHostPort(peer.TcpAddress())
+		if err != nil || net.ParseIP(host) == nil {
+			t.Errorf("peer address %s of seed %q can't be dialed", peer.TcpAddress(), test.raw)
+		}
+
+		if !peer.IsBootstrap {
+			t.Errorf("seed %q isn't a bootstrap peer", test.raw)
+		}
+	}
+}
+
+func TestParseInvalidSeeds(t *testing.T) {
+	for _, raw := range []string{"", "127.0.0.1", "::1:8080", "host:0", "host:http", ":8080"} {
+		_, err := ParseSeed(raw)
+		if err == nil {
+			t.Errorf("ParseSeed(%q) didn't fail", raw)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package node
+
+import (
+	"sync"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// seenCache remembers the hashes of the last announcements received, and which peer sent them first,
+// so announcements are handled and relayed once instead of looping between peers
+type seenCache struct {
+	mu      sync.Mutex
+	entries map[database.Hash]seenEntry
+
+	// ring of the hashes in the order they were seen, the oldest being forgotten first
+	order []database.Hash
+	next  int
+}
+
+type seenEntry struct {
+	origin string
+
+	// index of the hash in the ring, a forgotten hash seen again takes a new one
+	slot int
+}
+
+func newSeenCache(capacity int) *seenCache {
+	return &seenCache{
+		entries: make(map[database.Hash]seenEntry, capacity),
+		order:   make([]database.Hash, 0, capacity),
+	}
+}
+
+// add remembers hash as sent by the peer at origin, empty for this node. It reports false if hash was already seen
+func (c *seenCache) add(hash database.Hash, origin string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[hash]; ok {
+		return false
+	}
+
+	slot := len(c.order)
+	if len(c.order) < cap(c.order) {
+		c.order = append(c.order, hash)
+	} else {
+		slot = c.next
+		if evicted, ok := c.entries[c.order[slot]]; ok && evicted.slot == slot {
+			delete(c.entries, c.order[slot])
+		}
+		c.order[slot] = hash
+		c.next = (c.next + 1) % len(c.order)
+	}
+
+	c.entries[hash] = seenEntry{origin: origin, slot: slot}
+
+	return true
+}
+
+// forget drops hash, so it is handled again the next time it is announced
+func (c *seenCache) forget(hash database.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, hash)
+}
+
+// origin is the address of the peer hash was first seen from
+func (c *seenCache) origin(hash database.Hash) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[hash]
+
+	return entry.origin, ok
+}
@@ -2,81 +2,323 @@ package node
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/mycicle/MyChain/blockchain/node/client"
 	database "github.com/mycicle/MyChain/blockchain/src"
 )
 
+const DefaultSyncInterval = 45 * time.Second
+const DefaultSyncWorkers = 4
+const DefaultSyncRequestTimeout = 10 * time.Second
+const DefaultSyncPeerTimeout = time.Minute
+
+// Idle connections kept open to each peer, enough for every sync worker to reuse one
+const peerMaxIdleConnsPerHost = 2 * DefaultSyncWorkers
+
+// SyncConfig bounds how much of the node the sync with its peers can take, and how long a peer can stall it
+type SyncConfig struct {
+	// Time between two sync rounds, SyncNow runs one in between
+	Interval time.Duration
+
+	// Number of peers queried at the same time, and of block batches downloaded at the same time
+	Workers int
+
+	// Bound on every single request to a peer
+	RequestTimeout time.Duration
+
+	// Bound on querying and joining a single peer during a sync round, and on each download of its headers.
+	// Its blocks may take longer
+	PeerTimeout time.Duration
+}
+
+func DefaultSyncConfig() SyncConfig {
+	return SyncConfig{
+		Interval:       DefaultSyncInterval,
+		Workers:        DefaultSyncWorkers,
+		RequestTimeout: DefaultSyncRequestTimeout,
+		PeerTimeout:    DefaultSyncPeerTimeout,
+	}
+}
+
+// WithSync configures the sync with the peers, the zero fields of cfg keeping their default
+func WithSync(cfg SyncConfig) Option {
+	return func(n *Node) {
+		defaults := DefaultSyncConfig()
+		if cfg.Interval <= 0 {
+			cfg.Interval = defaults.Interval
+		}
+		if cfg.Workers <= 0 {
+			cfg.Workers = defaults.Workers
+		}
+		if cfg.RequestTimeout <= 0 {
+			cfg.RequestTimeout = defaults.RequestTimeout
+		}
+		if cfg.PeerTimeout <= 0 {
+			cfg.PeerTimeout = defaults.PeerTimeout
+		}
+
+		n.syncConfig = cfg
+	}
+}
+
+func newPeerTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = peerMaxIdleConnsPerHost
+
+	return transport
+}
+
+// peerSync is what a sync worker learned from a peer
+type peerSync struct {
+	peer       PeerNode
+	status     StatusRes
+	discovered int
+	err        error
+}
+
+// bodyBatch is a batch of blocks downloaded for the import queue
+type bodyBatch struct {
+	index  int
+	blocks []database.Block
+	err    error
+}
+
 func (n *Node) sync(ctx context.Context) error {
-	ticker := time.NewTicker(45 * time.Second)
+	ticker := time.NewTicker(n.syncConfig.Interval)
+
+	n.resolveSeeds(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
-			n.doSync()
+			if n.seedResolveInterval > 0 && time.Since(n.seedsResolvedAt) >= n.seedResolveInterval {
+				n.resolveSeeds(ctx)
+			}
+
+			n.doSync(ctx, false)
+
+		// rounds asked for by SyncNow run here too, never at the same time as a scheduled one
+		case res := <-n.syncRequests:
+			res <- n.doSync(ctx, true)
 
 		case <-ctx.Done():
 			ticker.Stop()
+			return ctx.Err()
 		}
 	}
 }
 
-func (n *Node) doSync() {
-	for _, peer := range n.knownPeers {
-		if n.ip == peer.IP && n.port == peer.Port {
-			continue
-		}
+// SyncNow runs a sync round right away, without waiting for the next one, and reports how it went with every peer
+func (n *Node) SyncNow(ctx context.Context) (SyncNowRes, error) {
+	start := time.Now()
+	res := make(chan []PeerSyncRes, 1)
+
+	select {
+	case n.syncRequests <- res:
+	case <-n.syncDone:
+		return SyncNowRes{}, errors.New("the node is not syncing")
+	case <-ctx.Done():
+		return SyncNowRes{}, ctx.Err()
+	}
 
-		fmt.Printf("Searching for new Peers and their Blocks and Peers: '%s'\n", peer.TcpAddress())
+	var peers []PeerSyncRes
+	select {
+	case peers = <-res:
+	case <-ctx.Done():
+		return SyncNowRes{}, ctx.Err()
+	}
 
-		status, err := queryPeerStatus(peer)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			fmt.Printf("Peer '%s' was removed from KnownPeers\n", peer.TcpAddress())
+	syncNowRes := SyncNowRes{
+		Hash:     n.state.LatestBlockHash(),
+		Number:   n.state.LatestBlock().Header.Number,
+		Duration: time.Since(start).String(),
+		Peers:    peers,
+	}
+
+	for _, peer := range peers {
+		syncNowRes.BlocksImported += peer.BlocksImported
+		syncNowRes.PeersDiscovered += peer.PeersDiscovered
+	}
 
-			n.RemovePeer(peer)
+	return syncNowRes, nil
+}
 
+// doSync syncs with the known peers and reports how it went with each. Banned peers are skipped,
+// and so are the peers backed off after failing unless force is set
+func (n *Node) doSync(ctx context.Context, force bool) []PeerSyncRes {
+	start := time.Now()
+	tried := 0
+	succeeded := 0
+	defer func() {
+		n.metrics.syncRoundDuration.Observe(time.Since(start).Seconds())
+		n.syncHealth.recordSyncRound(tried, succeeded)
+	}()
+
+	summaries := make([]PeerSyncRes, 0)
+
+	peers := make([]PeerNode, 0)
+	for _, peer := range n.KnownPeers() {
+		if n.ip == peer.IP && n.port == peer.Port {
 			continue
 		}
 
-		err = n.joinKnownPeers(peer)
-		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
+		if peer.isBanned(start) {
+			summaries = append(summaries, PeerSyncRes{Peer: peer.TcpAddress(), Skipped: fmt.Sprintf("banned until %s", unixTime(peer.BannedUntil))})
 			continue
 		}
 
-		err = n.syncBlocks(peer, status)
-		if err != nil {
-			fmt.Printf("ERROR: '%s'\n", err)
+		if peer.isBackedOff(start) && !force {
+			summaries = append(summaries, PeerSyncRes{Peer: peer.TcpAddress(), Skipped: fmt.Sprintf("backed off until %s", unixTime(peer.RetryAt))})
 			continue
 		}
 
-		err = n.syncKnownPeers(peer, status)
+		peers = append(peers, peer)
+	}
+	tried = len(peers)
+
+	synced := n.syncPeers(ctx, peers)
+
+	// the highest peers are synced first, so the others have no block left to send
+	sort.SliceStable(synced, func(i, j int) bool {
+		return synced[i].status.Number > synced[j].status.Number
+	})
+
+	for _, peerSync := range synced {
+		summary := PeerSyncRes{
+			Peer:            peerSync.peer.TcpAddress(),
+			Number:          peerSync.status.Number,
+			PeersDiscovered: peerSync.discovered,
+		}
+
+		err := peerSync.err
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil {
+			summary.BlocksImported, err = n.syncBlocks(ctx, peerSync.peer, peerSync.status)
+			if err != nil {
+				n.failPeerSync(peerSync.peer, err)
+			}
+		}
+
 		if err != nil {
-			fmt.Printf("ERROR: %s\n", err)
-			continue
+			summary.Error = err.Error()
+		} else {
+			n.recordPeerSuccess(peerSync.peer)
+			succeeded++
 		}
 
+		summaries = append(summaries, summary)
 	}
+
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return summaries[i].Peer < summaries[j].Peer
+	})
+
+	// peers which stopped answering are kept until they are too old, to survive short outages and restarts
+	n.prunePeers(time.Now())
+
+	err := n.savePeers()
+	if err != nil {
+		fmt.Printf("ERROR: unable to save the known peers. %s\n", err)
+	}
+
+	return summaries
+}
+
+func unixTime(unix uint64) string {
+	return time.Unix(int64(unix), 0).UTC().Format(time.RFC3339)
+}
+
+// syncPeers queries and joins peers, and learns the peers they know, with a pool of workers
+// so a peer which hangs only holds up its own worker until the peer timeout
+func (n *Node) syncPeers(ctx context.Context, peers []PeerNode) []peerSync {
+	synced := make([]peerSync, len(peers))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < n.syncConfig.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				synced[i] = n.syncPeer(ctx, peers[i])
+			}
+		}()
+	}
+
+	for i := range peers {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return synced
 }
 
-func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
+func (n *Node) syncPeer(ctx context.Context, peer PeerNode) peerSync {
+	ctx, cancel := context.WithTimeout(ctx, n.syncConfig.PeerTimeout)
+	defer cancel()
+
+	fmt.Printf("Searching for new Peers and their Blocks and Peers: '%s'\n", peer.TcpAddress())
+
+	status, err := queryPeerStatus(ctx, n.transport(peer))
+	if err != nil {
+		return n.failPeerSync(peer, err)
+	}
+
+	n.recordPeerSeen(peer, status.Number)
+
+	err = n.joinKnownPeers(ctx, peer)
+	if err != nil {
+		return n.failPeerSync(peer, err)
+	}
+
+	// the blocks are downloaded over the transport the handshake negotiated
+	if joined, ok := n.knownPeer(peer.TcpAddress()); ok {
+		peer = joined
+	}
+
+	discovered, err := n.syncKnownPeers(peer, status)
+	if err != nil {
+		return n.failPeerSync(peer, err)
+	}
+
+	return peerSync{peer: peer, status: status, discovered: discovered}
+}
+
+func (n *Node) failPeerSync(peer PeerNode, err error) peerSync {
+	fmt.Printf("ERROR: %s\n", err)
+	n.recordSyncError(peer, err)
+	n.recordPeerFailure(peer, err)
+
+	return peerSync{peer: peer, err: err}
+}
+
+// syncBlocks imports the blocks the peer has beyond the local tip and returns how many were imported
+func (n *Node) syncBlocks(ctx context.Context, peer PeerNode, status StatusRes) (int, error) {
 	localBlockNumber := n.state.LatestBlock().Header.Number
 
 	// if the peer has no blocks return nil
 	if status.Hash.IsEmpty() {
-		return nil
+		return 0, nil
 	}
 
 	if status.Number < localBlockNumber {
-		return nil
+		return 0, nil
 	}
 
 	// if its the genesis blocks and we already synced it, ignore it
 	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
-		return nil
+		return 0, nil
 	}
 
 	// Display found 1 new block if we sync the genesis block 0
@@ -86,147 +328,404 @@ func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
 	}
 	fmt.Printf("Found %d new blocks from Peer %s\n", newBlocksCount, peer.TcpAddress())
 
-	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
+	imported := 0
+	for {
+		// the headers are verified first, so no block is downloaded unless it belongs to a chain of valid links.
+		// Downloading them is bounded like querying the peer, the blocks may take longer
+		headersCtx, cancel := context.WithTimeout(ctx, n.syncConfig.PeerTimeout)
+		err := n.syncHeaders(headersCtx, peer, status)
+		timedOut := headersCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		// the blocks of the headers downloaded in time are imported anyway
+		if err != nil && (!timedOut || n.headers.len() == 0) {
+			return imported, err
+		}
+
+		count, err := n.syncBodies(ctx, peer)
+		imported += count
+		if err != nil {
+			return imported, err
+		}
+
+		// the pending headers are capped, the next ones are downloaded once the blocks of these are imported
+		if count == 0 || timedOut || n.state.LatestBlock().Header.Number >= status.Number {
+			return imported, nil
+		}
+	}
+}
+
+// syncHeaders downloads the headers up to the block number the peer reported, after the ones still pending
+// from an interrupted sync, and checks they chain together before keeping them. At most maxPendingHeaders are kept
+func (n *Node) syncHeaders(ctx context.Context, peer PeerNode, status StatusRes) error {
+	err := n.downloadHeaders(ctx, peer, status)
+
+	checkpointErr := n.checkpointHeaders(true)
+	if err == nil {
+		err = checkpointErr
+	}
+
+	return err
+}
+
+func (n *Node) downloadHeaders(ctx context.Context, peer PeerNode, status StatusRes) error {
+	err := n.resumeHeaders()
 	if err != nil {
 		return err
 	}
 
-	return n.state.AddBlocks(blocks)
-}
+	transport := n.transport(peer)
 
-// func syncHandler(w http.ResponseWriter, r *http.Request, dataDir string) {
-// 	reqHash := r.URL.Query.Get(endpointSyncQueryKeyFromBlock)
+	for n.headers.len() < maxPendingHeaders {
+		parent := n.localTip()
+		if last, ok := n.headers.last(); ok {
+			parent = last
+		}
 
-// 	hash := database.Hash{}
-// 	err := hash.UnmarshalText([]byte(reqHash))
-// 	if err != nil {
-// 		writeErrRes(w, err)
-// 		return
-// 	}
+		if !parent.Key.IsEmpty() && parent.Value.Number >= status.Number {
+			return nil
+		}
 
-// 	blocks, err := database.GetBlocksAfter(hash, dataDir)
-// 	if err != nil {
-// 		writeErrRes(w, err)
-// 		return
-// 	}
+		headersRes, err := transport.Headers(ctx, parent.Key, syncHeadersBatch)
 
-// 	writeRes(w, SyncRes{Blocks: blocks})
-// }
+		// the pending headers came from a chain the peer doesn't have, start again from the local tip
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && n.headers.len() > 0 {
+			fmt.Printf("Peer %s doesn't know the pending headers, downloading them again\n", peer.TcpAddress())
 
-// func (n *Node) fetchNewBlocksAndPeers() {
-// 	for _, peer := range n.knownPeers {
-// 		status, err := queryPeerStatus(peer)
-// 		if err != nil {
-// 			fmt.Printf("ERROR: %s\n", err)
-// 			continue
-// 		}
+			err = n.resetHeaders()
+			if err != nil {
+				return err
+			}
 
-// 		localBlockNumber := n.state.LatestBlock().Header.Number
-// 		// if localBlockNumber < status.Number {
-// 		// 	newBlocksCount := status.Number - localBlockNumber
-// 		// }
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(headersRes.Headers) == 0 {
+			return nil
+		}
 
-// 		for _, statusPeer := range status.KnownPeers {
-// 			newPeer, isKnownPeer := n.knownPeers[statusPeer.TcpAddress()]
-// 			if !isKnownPeer {
-// 				fmt.Printf("Found new Peer %s\n", peer.TcpAddress())
+		err = database.VerifyHeaders(parent, headersRes.Headers)
+		if err != nil {
+			return err
+		}
 
-// 				n.knownPeers[statusPeer.TcpAddress()] = newPeer
-// 			}
-// 		}
-// 	}
-// }
+		n.headers.append(headersRes.Headers)
 
-func queryPeerStatus(peer PeerNode) (StatusRes, error) {
-	url := fmt.Sprintf("http://%s%s", peer.TcpAddress(), endpointStatus)
-	res, err := http.Get(url)
-	if err != nil {
-		return StatusRes{}, err
+		err = n.checkpointHeaders(false)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Downloaded headers up to block %d of %d from Peer %s\n", headersRes.Headers[len(headersRes.Headers)-1].Value.Number, status.Number, peer.TcpAddress())
+
+		if !headersRes.More {
+			return nil
+		}
 	}
 
-	statusRes := StatusRes{}
-	err = readRes(res, &statusRes)
+	return nil
+}
+
+// syncBodies downloads the blocks of the pending headers in bounded batches, several at the same time and
+// asked in turn to the peer the headers came from and to the other peers which reported a height covering them.
+// The batches go through a single import queue which adds them to the state in chain order. It returns how many were imported
+func (n *Node) syncBodies(ctx context.Context, peer PeerNode) (int, error) {
+	err := n.resumeHeaders()
 	if err != nil {
-		return StatusRes{}, err
+		return 0, err
+	}
+
+	headers := n.headers.pending()
+	if len(headers) == 0 {
+		return 0, nil
 	}
 
-	return statusRes, nil
+	target := headers[len(headers)-1].Value.Number
+
+	batches := make([][]database.HeaderFS, 0, len(headers)/syncBlocksBatch+1)
+	for len(headers) > 0 {
+		size := syncBlocksBatch
+		if len(headers) < size {
+			size = len(headers)
+		}
+
+		batches = append(batches, headers[:size])
+		headers = headers[size:]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// a batch is handed to a worker only when few enough are downloaded ahead of the import, bounding memory
+	window := make(chan struct{}, 2*n.syncConfig.Workers)
+	jobs := make(chan int)
+	fetched := make(chan bodyBatch)
+
+	go func() {
+		defer close(jobs)
+
+		for i := range batches {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < n.syncConfig.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				blocks, err := n.fetchBodies(ctx, peer, batches[i], i)
+
+				select {
+				case fetched <- bodyBatch{index: i, blocks: blocks, err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+
+	imported, err := n.importBodies(ctx, fetched, window, len(batches), target)
+
+	// stop the workers still downloading, and wait for them so none outlives the sync round
+	cancel()
+	for range fetched {
+	}
+
+	checkpointErr := n.checkpointHeaders(true)
+	if err == nil {
+		err = checkpointErr
+	}
+
+	return imported, err
 }
 
-func (n *Node) joinKnownPeers(peer PeerNode) error {
-	if peer.connected {
-		return nil
+// importBodies is the import queue: it adds the downloaded batches to the state one after the other, in chain order
+func (n *Node) importBodies(ctx context.Context, fetched <-chan bodyBatch, window <-chan struct{}, batches int, target uint64) (int, error) {
+	downloaded := make(map[int]bodyBatch)
+	next := 0
+	imported := 0
+
+	for batch := range fetched {
+		downloaded[batch.index] = batch
+
+		for {
+			batch, ok := downloaded[next]
+			if !ok {
+				break
+			}
+
+			delete(downloaded, next)
+			next++
+			<-window
+
+			if batch.err != nil {
+				return imported, batch.err
+			}
+
+			count, err := n.importBlocks(batch.blocks)
+			imported += count
+			if err != nil {
+				return imported, err
+			}
+
+			fmt.Printf("Imported blocks up to %d of %d\n", n.state.LatestBlock().Header.Number, target)
+		}
+
+		if next == batches {
+			return imported, nil
+		}
 	}
 
-	url := fmt.Sprintf(
-		"http://%s%s?%s=%s&%s=%d",
-		peer.TcpAddress(),
-		endpointAddPeer,
-		endpointAddPeerQueryKeyIP,
-		n.ip,
-		endpointAddPeerQueryKeyPort,
-		n.port,
-	)
+	return imported, ctx.Err()
+}
 
-	res, err := http.Get(url)
-	if err != nil {
-		return err
+// importBlocks adds synced blocks to the state, skipping the ones a peer pushed meanwhile, and trims the pending headers.
+// It returns how many were added, up to the first one failing
+func (n *Node) importBlocks(blocks []database.Block) (int, error) {
+	tip := n.localTip()
+	for len(blocks) > 0 && !tip.Key.IsEmpty() && blocks[0].Header.Number <= tip.Value.Number {
+		blocks = blocks[1:]
 	}
 
-	addPeerRes := AddPeerRes{}
-	err = readRes(res, &addPeerRes)
+	imported := 0
+	var err error
+	for _, b := range blocks {
+		_, err = n.state.AddBlock(b)
+		if err != nil {
+			break
+		}
+
+		imported++
+	}
+
+	// the blocks don't apply on the local state, the headers leading to them are worthless
+	var invalidBlockErr *database.InvalidBlockError
+	if errors.As(err, &invalidBlockErr) {
+		resetErr := n.resetHeaders()
+		if resetErr != nil {
+			fmt.Printf("ERROR: unable to reset the pending headers. %s\n", resetErr)
+		}
+	}
 	if err != nil {
-		return err
+		return imported, err
 	}
-	if addPeerRes.Error != "" {
-		return fmt.Errorf(addPeerRes.Error)
+
+	return imported, n.resumeHeaders()
+}
+
+// fetchBodies downloads the blocks of headers, from a peer picked in turn for each batch.
+// A helper peer failing to serve them is backed off and the batch is asked to peer instead
+func (n *Node) fetchBodies(ctx context.Context, peer PeerNode, headers []database.HeaderFS, batch int) ([]database.Block, error) {
+	sources := append([]PeerNode{peer}, n.bodyPeers(peer, headers[len(headers)-1].Value.Number)...)
+	source := sources[batch%len(sources)]
+
+	blocks, err := fetchVerifiedBodies(ctx, n.transport(source), headers)
+	if err != nil && ctx.Err() == nil && source.TcpAddress() != peer.TcpAddress() {
+		fmt.Printf("ERROR: %s\n", err)
+		n.recordPeerFailure(source, err)
+
+		return fetchVerifiedBodies(ctx, n.transport(peer), headers)
 	}
 
-	knownPeer := n.knownPeers[peer.TcpAddress()]
-	knownPeer.connected = addPeerRes.Success
+	return blocks, err
+}
+
+// bodyPeers lists the joined peers other than peer which reported at least the given height, sorted for a stable rotation
+func (n *Node) bodyPeers(peer PeerNode, height uint64) []PeerNode {
+	now := time.Now()
 
-	n.AddPeer(knownPeer)
+	peers := make([]PeerNode, 0)
+	for tcpAddress, known := range n.KnownPeers() {
+		if tcpAddress == peer.TcpAddress() || (known.IP == n.ip && known.Port == n.port) {
+			continue
+		}
+
+		if !known.connected || known.Height < height || known.isBanned(now) || known.isBackedOff(now) {
+			continue
+		}
 
-	if !addPeerRes.Success {
-		return fmt.Errorf("unable to join KnownPeers of '%s'", peer.TcpAddress())
+		peers = append(peers, known)
 	}
 
-	return nil
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].TcpAddress() < peers[j].TcpAddress()
+	})
+
+	return peers
 }
 
-func fetchBlocksFromPeer(peer PeerNode, fromBlock database.Hash) ([]database.Block, error) {
-	fmt.Printf("Importing blocks from Peer %s...\n", peer.TcpAddress())
+// fetchVerifiedBodies downloads the blocks of headers and checks each hashes to its header,
+// asking again from the first missing block when the peer sends fewer than asked
+func fetchVerifiedBodies(ctx context.Context, peer Transport, headers []database.HeaderFS) ([]database.Block, error) {
+	fmt.Printf("Importing blocks from Peer %s...\n", peer.BaseURL())
 
-	url := fmt.Sprintf(
-		"http://%s%s?%s=%s",
-		peer.TcpAddress(),
-		endpointSync,
-		endpointSyncQueryKeyFromBlock,
-		fromBlock.Hex(),
-	)
+	blocks := make([]database.Block, 0, len(headers))
+	for len(blocks) < len(headers) {
+		from := headers[len(blocks)].Value.Number
 
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
+		blocksRes, err := peer.Blocks(ctx, from, len(headers)-len(blocks))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(blocksRes.Blocks) == 0 {
+			return nil, fmt.Errorf("peer '%s' has no block from %d", peer.BaseURL(), from)
+		}
+
+		for _, blockFs := range blocksRes.Blocks {
+			if len(blocks) == len(headers) {
+				break
+			}
+
+			header := headers[len(blocks)]
+
+			hash, err := blockFs.Value.Hash()
+			if err != nil {
+				return nil, err
+			}
+
+			if hash != header.Key {
+				return nil, &database.InvalidBlockError{
+					Number: header.Value.Number,
+					Err:    fmt.Errorf("block %d hashes to '%x' instead of its header '%x'", header.Value.Number, hash, header.Key),
+				}
+			}
+
+			blocks = append(blocks, blockFs.Value)
+		}
 	}
 
-	syncRes := SyncRes{}
-	err = readRes(res, &syncRes)
+	return blocks, nil
+}
+
+func queryPeerStatus(ctx context.Context, peer Transport) (StatusRes, error) {
+	return peer.Status(ctx)
+}
+
+func (n *Node) joinKnownPeers(ctx context.Context, peer PeerNode) error {
+	if peer.connected {
+		return nil
+	}
+
+	handshakeRes, err := n.peerClient(peer).Handshake(ctx, n.nodeInfo())
+
+	// nodes of protocol version 1 don't know the handshake
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return &client.HandshakeError{Peer: peer.TcpAddress(), Reason: fmt.Sprintf("the peer speaks a protocol version older than %d", MinProtocolVersion)}
+	}
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	// the peer accepted this node, but this node checks the peer as well
+	reason := n.checkNodeInfo(handshakeRes.Node)
+	if reason != "" {
+		return &client.HandshakeError{Peer: peer.TcpAddress(), Reason: reason}
 	}
 
-	return syncRes.Blocks, nil
+	n.negotiate(peer, handshakeRes.Node)
+
+	return nil
 }
 
-func (n *Node) syncKnownPeers(peer PeerNode, status StatusRes) error {
+// syncKnownPeers adds the peers known by peer and returns how many were new. The bootstrap flag peer claims for
+// them is ignored: bootstrap peers are trusted with the credentials of the node, so only its configuration sets it
+func (n *Node) syncKnownPeers(peer PeerNode, status StatusRes) (int, error) {
+	discovered := 0
+
 	for _, statusPeer := range status.KnownPeers {
-		if !n.IsKnownPeer(statusPeer) {
-			fmt.Printf("Found new Peer %s\n", statusPeer.TcpAddress())
+		newPeer := NewPeerNode(statusPeer.IP, statusPeer.Port, false, false)
+
+		if !n.IsKnownPeer(newPeer) {
+			fmt.Printf("Found new Peer %s\n", newPeer.TcpAddress())
 
-			n.AddPeer(statusPeer)
+			n.AddPeer(newPeer)
+			discovered++
 		}
 	}
 
-	return nil
+	return discovered, nil
 }
@@ -0,0 +1,353 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/wire"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// Connections without any request for longer are closed
+const tcpIdleTimeout = 5 * time.Minute
+
+// How long a client is given to answer the challenge once connected
+const tcpAuthTimeout = 10 * time.Second
+
+// Requests of a single connection served at once, the next ones wait
+const tcpMaxInFlight = 16
+
+// WithTCP serves the sync and gossip requests of the peers over a persistent TCP connection as well,
+// on the given port. With 0 a free port is picked when the node starts
+func WithTCP(port uint64) Option {
+	return func(n *Node) {
+		n.tcpEnabled = true
+		n.tcpPort = port
+	}
+}
+
+// TCPAddr is the ip:port of the TCP transport, empty when it is off. Once started, it holds the port actually bound
+func (n *Node) TCPAddr() string {
+	if !n.tcpEnabled {
+		return ""
+	}
+
+	return hostPort(n.ip, n.tcpPort)
+}
+
+// serveTCP accepts connections until the listener is closed by Stop
+func (n *Node) serveTCP(listener net.Listener) {
+	defer n.tcpWorkers.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if !n.trackTCPConn(conn, true) {
+			conn.Close()
+			return
+		}
+
+		n.tcpWorkers.Add(1)
+		go func() {
+			defer n.tcpWorkers.Done()
+			defer n.trackTCPConn(conn, false)
+
+			n.serveTCPConn(conn)
+		}()
+	}
+}
+
+// trackTCPConn records the open connections for Stop to close them. It reports false once the node is stopping
+func (n *Node) trackTCPConn(conn net.Conn, open bool) bool {
+	n.tcpMu.Lock()
+	defer n.tcpMu.Unlock()
+
+	if !open {
+		delete(n.tcpConns, conn)
+		return true
+	}
+
+	if n.tcpConns == nil {
+		return false
+	}
+
+	n.tcpConns[conn] = struct{}{}
+
+	return true
+}
+
+// closeTCP stops accepting connections, closes the open ones and waits for their requests to complete
+func (n *Node) closeTCP() {
+	n.tcpPool.close()
+
+	if n.tcpListener == nil {
+		return
+	}
+
+	n.tcpListener.Close()
+
+	n.tcpMu.Lock()
+	for conn := range n.tcpConns {
+		conn.Close()
+	}
+	n.tcpConns = nil
+	n.tcpMu.Unlock()
+
+	n.tcpWorkers.Wait()
+}
+
+// serveTCPConn challenges the client for its credentials, then serves its requests at once
+func (n *Node) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+
+	conn.SetDeadline(time.Now().Add(tcpAuthTimeout))
+
+	authenticated, err := n.authenticateTCP(conn)
+	if err != nil {
+		fmt.Printf("ERROR: TCP connection from '%s' closed. %s\n", conn.RemoteAddr(), err)
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	maxRequest := wire.MaxFrameSize
+	if n.limits.MaxBodyBytes > 0 && n.limits.MaxBodyBytes < int64(maxRequest) {
+		maxRequest = int(n.limits.MaxBodyBytes)
+	}
+
+	writeMu := sync.Mutex{}
+	inFlight := make(chan struct{}, tcpMaxInFlight)
+	requests := sync.WaitGroup{}
+	defer requests.Wait()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+
+		frame, err := wire.ReadFrame(conn, maxRequest)
+		if err != nil {
+			return
+		}
+
+		inFlight <- struct{}{}
+		requests.Add(1)
+		go func() {
+			defer requests.Done()
+			defer func() { <-inFlight }()
+
+			res := n.serveTCPRequest(frame, ip, authenticated)
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+
+			err := wire.WriteFrame(conn, res)
+			if err != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// authenticateTCP sends a challenge and checks the credentials answering it. As over HTTP, a client without
+// valid credentials is still served the public requests
+func (n *Node) authenticateTCP(conn net.Conn) (bool, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return false, err
+	}
+
+	payload, err := wire.Encode(wire.Hello{Version: wire.Version, Challenge: challenge})
+	if err != nil {
+		return false, err
+	}
+
+	err = wire.WriteFrame(conn, wire.Frame{Op: wire.OpHello, Payload: payload})
+	if err != nil {
+		return false, err
+	}
+
+	frame, err := wire.ReadFrame(conn, int(DefaultMaxBodyBytes))
+	if err != nil {
+		return false, err
+	}
+
+	auth := wire.Auth{}
+	if frame.Op != wire.OpAuth || wire.Decode(frame.Payload, &auth) != nil {
+		return false, fmt.Errorf("expected the credentials, got a %s frame", frame.Op)
+	}
+
+	authenticated := !n.auth.Enabled() || n.checkTCPCredentials(auth, challenge) == nil
+
+	payload, err = wire.Encode(wire.AuthRes{Authenticated: authenticated})
+	if err != nil {
+		return false, err
+	}
+
+	return authenticated, wire.WriteFrame(conn, wire.Frame{ID: frame.ID, Op: wire.OpResult, Payload: payload})
+}
+
+// checkTCPCredentials accepts the API tokens and the HMAC secret checkCredentials accepts
+func (n *Node) checkTCPCredentials(auth wire.Auth, challenge []byte) error {
+	if auth.Token != "" {
+		for _, accepted := range n.auth.Tokens {
+			if subtle.ConstantTimeCompare([]byte(auth.Token), []byte(accepted)) == 1 {
+				return nil
+			}
+		}
+	}
+
+	if auth.Signature != "" {
+		if len(n.auth.HMACSecret) == 0 {
+			return fmt.Errorf("signed requests are not accepted by this node")
+		}
+
+		return wire.VerifySignature(challenge, n.auth.HMACSecret, auth.Signature)
+	}
+
+	if auth.Token != "" {
+		return fmt.Errorf("invalid API token")
+	}
+
+	return fmt.Errorf("missing API token or signature")
+}
+
+// serveTCPRequest answers a request frame, enforcing the policy and rate limit of the matching HTTP route
+func (n *Node) serveTCPRequest(frame wire.Frame, ip string, authenticated bool) wire.Frame {
+	start := time.Now()
+	route := frame.Op.Endpoint()
+
+	res, err := n.handleTCPRequest(frame, route, ip, authenticated)
+
+	code := http.StatusOK
+	if err != nil {
+		code = http.StatusInternalServerError
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			code = statusErr.code
+		}
+	}
+
+	// the op is sent by the client, unknown ones share a series
+	op := "other"
+	if route != "" {
+		op = frame.Op.String()
+	}
+
+	n.metrics.tcpRequests.Inc(op, strconv.Itoa(code))
+	n.metrics.tcpRequestDuration.Observe(time.Since(start).Seconds(), op)
+
+	var payload []byte
+	if err == nil {
+		payload, err = wire.Encode(res)
+	}
+	if err != nil {
+		payload, _ = wire.Encode(wire.Error{Code: code, Message: err.Error()})
+		return wire.Frame{ID: frame.ID, Op: wire.OpError, Payload: payload}
+	}
+
+	return wire.Frame{ID: frame.ID, Op: wire.OpResult, Payload: payload}
+}
+
+func (n *Node) handleTCPRequest(frame wire.Frame, route string, ip string, authenticated bool) (interface{}, error) {
+	if route == "" {
+		return nil, &statusError{code: http.StatusBadRequest, msg: fmt.Sprintf("unknown %s", frame.Op)}
+	}
+
+	if n.auth.Enabled() && !authenticated && n.auth.routePolicy(route) == PolicyAuthenticated {
+		return nil, &statusError{code: http.StatusUnauthorized, msg: "unauthorized. missing API token or signature"}
+	}
+
+	if rate, ok := n.limits.RouteRates[route]; ok {
+		_, allowed := n.rateLimiter.allow(route, ip, rate, time.Now())
+		if !allowed {
+			return nil, &statusError{code: http.StatusTooManyRequests, msg: fmt.Sprintf("too many requests to '%s'", route)}
+		}
+	}
+
+	badRequest := func(err error) error {
+		return &statusError{code: http.StatusBadRequest, msg: fmt.Sprintf("unable to decode the request. %s", err.Error())}
+	}
+
+	switch frame.Op {
+	case wire.OpStatus:
+		return n.status(), nil
+
+	case wire.OpHeaders:
+		req := wire.HeadersReq{}
+		err := wire.Decode(frame.Payload, &req)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		limit, err := capLimit(req.Limit, n.limits.MaxSyncHeaders)
+		if err != nil {
+			return nil, &statusError{code: http.StatusBadRequest, msg: err.Error()}
+		}
+
+		return n.headersAfter(req.FromBlock, limit)
+
+	case wire.OpBlocks:
+		req := wire.BlocksReq{}
+		err := wire.Decode(frame.Payload, &req)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		limit, err := capLimit(req.Limit, n.limits.MaxSyncBlocks)
+		if err != nil {
+			return nil, &statusError{code: http.StatusBadRequest, msg: err.Error()}
+		}
+
+		blocks, more, err := database.GetBlocksFrom(req.FromNumber, n.dataDir, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return BlocksRes{Blocks: blocks, More: more}, nil
+
+	case wire.OpBlockAnnounce:
+		req := BlockAnnounceReq{}
+		err := wire.Decode(frame.Payload, &req)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		return announceResult(n.receiveBlock(req, ip))
+
+	case wire.OpTxAnnounce:
+		req := TxAnnounceReq{}
+		err := wire.Decode(frame.Payload, &req)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		return announceResult(n.receiveTx(req))
+	}
+
+	return nil, &statusError{code: http.StatusBadRequest, msg: fmt.Sprintf("unknown %s", frame.Op)}
+}
+
+// announceResult turns the response of a rejected announcement into the error the HTTP client would return
+func announceResult(res AnnounceRes, code int) (interface{}, error) {
+	if code != http.StatusOK {
+		return nil, &statusError{code: code, msg: res.Error}
+	}
+
+	return res, nil
+}
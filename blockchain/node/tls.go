@@ -0,0 +1,68 @@
+package node
+
+import (
+	"crypto/tls"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+type TLSConfig struct {
+	// Certificate and key the HTTP API is served with. When set, peers are reached over HTTPS as well
+	CertFile string
+	KeyFile  string
+
+	// PEM bundle of private CAs trusted when connecting to peers
+	CAFile string
+
+	// client.CertFingerprint of the peer certificates to accept, e.g. self-signed ones
+	PinnedCerts []string
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// WithTLS serves the HTTP API over TLS and verifies peer certificates against cfg.
+// It configures the transport of the node's http.Client unless WithHTTPClient provided a custom one
+func WithTLS(cfg TLSConfig) Option {
+	return func(n *Node) {
+		n.tls = cfg
+	}
+}
+
+// setupTLS loads the server certificate and the peer verification settings
+func (n *Node) setupTLS() (*tls.Config, error) {
+	if n.tls.CAFile != "" || len(n.tls.PinnedCerts) > 0 {
+		peerTLSConfig, err := client.NewTLSConfig(n.tls.CAFile, n.tls.PinnedCerts)
+		if err != nil {
+			return nil, err
+		}
+
+		if n.peerTransport != nil {
+			n.peerTransport.TLSClientConfig = peerTLSConfig
+		}
+	}
+
+	if !n.tls.Enabled() {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(n.tls.CertFile, n.tls.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}, nil
+}
+
+// peerScheme is the scheme of the peers' API, which is expected to match this node's
+func (n *Node) peerScheme() string {
+	if n.tls.Enabled() {
+		return "https"
+	}
+
+	return "http"
+}
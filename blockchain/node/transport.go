@@ -0,0 +1,238 @@
+package node
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	"github.com/mycicle/MyChain/blockchain/node/wire"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// Transport carries the requests a node makes to a peer while syncing and gossiping.
+// *client.Client sends them over HTTP, and tcpTransport over the TCP transport of the peer
+type Transport interface {
+	Status(ctx context.Context) (StatusRes, error)
+	Headers(ctx context.Context, fromBlock database.Hash, limit int) (HeadersRes, error)
+	Blocks(ctx context.Context, fromNumber uint64, limit int) (BlocksRes, error)
+	AnnounceBlock(ctx context.Context, req BlockAnnounceReq) (AnnounceRes, error)
+	AnnounceTx(ctx context.Context, req TxAnnounceReq) (AnnounceRes, error)
+	BaseURL() string
+}
+
+// transport picks the TCP transport of the peer when it serves one, HTTP otherwise.
+// The handshake always goes over HTTP, as the TCP port is only known once it is done
+func (n *Node) transport(peer PeerNode) Transport {
+	if !peer.supports(FeatureTCP) || peer.TCPPort == 0 {
+		return n.peerClient(peer)
+	}
+
+	return &tcpTransport{
+		addr:     hostPort(peer.IP, peer.TCPPort),
+		trusted:  n.isTrustedPeer(peer),
+		timeout:  n.syncConfig.RequestTimeout,
+		pool:     n.tcpPool,
+		fallback: n.peerClient(peer),
+	}
+}
+
+// tcpTransport sends the requests over a connection of the pool, or over HTTP when the peer can't be reached on TCP
+type tcpTransport struct {
+	addr     string
+	trusted  bool
+	timeout  time.Duration
+	pool     *tcpPool
+	fallback *client.Client
+}
+
+func (t *tcpTransport) BaseURL() string {
+	return "tcp://" + t.addr
+}
+
+func (t *tcpTransport) Status(ctx context.Context) (StatusRes, error) {
+	res := StatusRes{}
+	err := t.call(ctx, wire.OpStatus, nil, &res, true)
+	if errors.Is(err, errTCPUnreachable) {
+		return t.fallback.Status(ctx)
+	}
+
+	return res, err
+}
+
+func (t *tcpTransport) Headers(ctx context.Context, fromBlock database.Hash, limit int) (HeadersRes, error) {
+	res := HeadersRes{}
+	err := t.call(ctx, wire.OpHeaders, wire.HeadersReq{FromBlock: fromBlock, Limit: limit}, &res, true)
+	if errors.Is(err, errTCPUnreachable) {
+		return t.fallback.Headers(ctx, fromBlock, limit)
+	}
+
+	return res, err
+}
+
+func (t *tcpTransport) Blocks(ctx context.Context, fromNumber uint64, limit int) (BlocksRes, error) {
+	res := BlocksRes{}
+	err := t.call(ctx, wire.OpBlocks, wire.BlocksReq{FromNumber: fromNumber, Limit: limit}, &res, true)
+	if errors.Is(err, errTCPUnreachable) {
+		return t.fallback.Blocks(ctx, fromNumber, limit)
+	}
+
+	return res, err
+}
+
+func (t *tcpTransport) AnnounceBlock(ctx context.Context, req BlockAnnounceReq) (AnnounceRes, error) {
+	res := AnnounceRes{}
+	err := t.call(ctx, wire.OpBlockAnnounce, req, &res, false)
+	if errors.Is(err, errTCPUnreachable) {
+		return t.fallback.AnnounceBlock(ctx, req)
+	}
+
+	return res, err
+}
+
+func (t *tcpTransport) AnnounceTx(ctx context.Context, req TxAnnounceReq) (AnnounceRes, error) {
+	res := AnnounceRes{}
+	err := t.call(ctx, wire.OpTxAnnounce, req, &res, false)
+	if errors.Is(err, errTCPUnreachable) {
+		return t.fallback.AnnounceTx(ctx, req)
+	}
+
+	return res, err
+}
+
+var errTCPUnreachable = errors.New("the TCP transport of the peer is unreachable")
+
+// call sends the request over a pooled connection. An idempotent request is sent once more on a new connection
+// when the pooled one broke, e.g. closed by the peer while idle
+func (t *tcpTransport) call(ctx context.Context, op wire.Op, req interface{}, res interface{}, idempotent bool) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		conn, err := t.pool.get(ctx, t.addr, t.trusted)
+		if err != nil {
+			fmt.Printf("WARNING: unable to connect to %s, falling back to HTTP. %s\n", t.BaseURL(), err)
+			return errTCPUnreachable
+		}
+
+		err = conn.Call(ctx, op, req, res)
+
+		var connErr *client.ConnError
+		if !errors.As(err, &connErr) || conn.Err() == nil || !idempotent || attempt > 0 || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// Connections unused for longer are closed by the pool before the peer's idle timeout closes them
+const tcpPoolIdleTimeout = tcpIdleTimeout / 2
+
+// tcpPool keeps a connection open to the TCP transport of each peer, shared by all the requests to the peer.
+// A peer trusted once its connection is open gets a new one, authenticated with the credentials of the node
+type tcpPool struct {
+	mu     sync.Mutex
+	conns  map[tcpPoolKey]*wire.Conn
+	closed bool
+
+	dial func(ctx context.Context, addr string, trusted bool) (*wire.Conn, error)
+}
+
+type tcpPoolKey struct {
+	addr    string
+	trusted bool
+}
+
+func newTCPPool(dial func(ctx context.Context, addr string, trusted bool) (*wire.Conn, error)) *tcpPool {
+	return &tcpPool{
+		conns: make(map[tcpPoolKey]*wire.Conn),
+		dial:  dial,
+	}
+}
+
+// get returns the open connection to addr, or dials a new one
+func (p *tcpPool) get(ctx context.Context, addr string, trusted bool) (*wire.Conn, error) {
+	key := tcpPoolKey{addr: addr, trusted: trusted}
+
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	if ok && (conn.Err() != nil || time.Since(conn.IdleSince()) > tcpPoolIdleTimeout) {
+		conn.Close()
+		delete(p.conns, key)
+		ok = false
+	}
+	closed := p.closed
+	p.mu.Unlock()
+
+	if ok {
+		return conn, nil
+	}
+	if closed {
+		return nil, fmt.Errorf("the node is stopped")
+	}
+
+	conn, err := p.dial(ctx, addr, trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// another request dialed the peer meanwhile, or the node stopped
+	if existing, ok := p.conns[key]; ok && existing.Err() == nil {
+		conn.Close()
+		return existing, nil
+	}
+	if p.closed {
+		conn.Close()
+		return nil, fmt.Errorf("the node is stopped")
+	}
+
+	p.conns[key] = conn
+
+	return conn, nil
+}
+
+func (p *tcpPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, key)
+	}
+
+	p.closed = true
+}
+
+// dialTCP connects to the TCP transport of a peer, with the credentials the node presents to the trusted peers
+func (n *Node) dialTCP(ctx context.Context, addr string, trusted bool) (*wire.Conn, error) {
+	creds := wire.Credentials{}
+	if trusted {
+		creds.Token = n.auth.PeerToken
+		creds.HMACSecret = n.auth.HMACSecret
+	}
+
+	return wire.Dial(ctx, addr, n.peerTLSConfig(), creds)
+}
+
+// peerTLSConfig is the TLS configuration the HTTP client verifies peers with, nil when peers aren't reached over TLS
+func (n *Node) peerTLSConfig() *tls.Config {
+	if !n.tls.Enabled() {
+		return nil
+	}
+
+	if n.peerTransport != nil && n.peerTransport.TLSClientConfig != nil {
+		return n.peerTransport.TLSClientConfig.Clone()
+	}
+
+	if transport, ok := n.httpClient.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig.Clone()
+	}
+
+	return &tls.Config{}
+}
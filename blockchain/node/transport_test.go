@@ -0,0 +1,127 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	"github.com/mycicle/MyChain/blockchain/node/wire"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+func TestTCPTransportRoundTrip(t *testing.T) {
+	a := startTestNode(t, WithTCP(0))
+
+	peer := testPeer(t, a)
+	peer.Features = []string{FeatureTCP}
+	peer.TCPPort = a.tcpPort
+
+	b := startTestNode(t)
+	transport := b.transport(peer)
+	if !strings.HasPrefix(transport.BaseURL(), "tcp://") {
+		t.Fatalf("the peer is reached through %s, want its TCP transport", transport.BaseURL())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := transport.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Hash != a.state.LatestBlockHash() {
+		t.Errorf("status of block %x, want %x", status.Hash, a.state.LatestBlockHash())
+	}
+
+	// fresh blocks, empty or not, hash to their key once decoded. The blocks of the committed database predate
+	// the block number and don't
+	legacy := a.state.LatestBlock().Header.Number
+	for _, txs := range [][]database.Tx{{}, {database.NewTx("andrej", "babayaga", 1, "")}} {
+		_, err := a.state.AppendBlock(txs, uint64(time.Now().Unix()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks, err := transport.Blocks(ctx, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks.Blocks) == 0 || blocks.Blocks[len(blocks.Blocks)-1].Key != a.state.LatestBlockHash() {
+		t.Fatalf("got %d blocks, not ending with the latest one", len(blocks.Blocks))
+	}
+
+	// the blocks decoded from gob must be the ones served over HTTP
+	httpBlocks, err := b.peerClient(peer).Blocks(ctx, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blocks, httpBlocks) {
+		t.Errorf("the blocks sent over TCP differ from the ones sent over HTTP")
+	}
+
+	for _, block := range blocks.Blocks {
+		if block.Value.Header.Number <= legacy {
+			continue
+		}
+
+		hash, err := block.Value.Hash()
+		if err != nil || hash != block.Key {
+			t.Errorf("block %d hashes to %x once decoded, want %x", block.Value.Header.Number, hash, block.Key)
+		}
+	}
+
+	headers, err := transport.Headers(ctx, blocks.Blocks[0].Key, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers.Headers) != len(blocks.Blocks)-1 {
+		t.Errorf("got %d headers after the first block, want %d", len(headers.Headers), len(blocks.Blocks)-1)
+	}
+
+	tx := database.NewTx("andrej", "babayaga", 1, "over tcp")
+	res, err := transport.AnnounceTx(ctx, TxAnnounceReq{Tx: tx})
+	if err != nil || !res.Accepted {
+		t.Fatalf("the announced TX wasn't accepted: %+v %v", res, err)
+	}
+
+	res, err = transport.AnnounceTx(ctx, TxAnnounceReq{Tx: tx})
+	if err != nil || !res.Known {
+		t.Errorf("the TX announced again isn't known: %+v %v", res, err)
+	}
+}
+
+func TestTCPTransportRejectsOversizedRequests(t *testing.T) {
+	a := startTestNode(t, WithTCP(0), WithLimits(Limits{MaxBodyBytes: 1024}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := wire.Dial(ctx, a.TCPAddr(), nil, wire.Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	status := StatusRes{}
+	err = conn.Call(ctx, wire.OpStatus, nil, &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := database.NewTx("andrej", "babayaga", 1, strings.Repeat("x", 2048))
+	err = conn.Call(ctx, wire.OpTxAnnounce, TxAnnounceReq{Tx: tx}, &AnnounceRes{})
+
+	var connErr *client.ConnError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("the oversized request failed with %v, want the connection to be closed", err)
+	}
+
+	if a.state.MempoolSize() != 0 {
+		t.Error("the oversized TX was added to the mempool")
+	}
+}
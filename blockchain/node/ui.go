@@ -0,0 +1,23 @@
+package node
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const endpointUI = "/ui/"
+
+// the web wallet and explorer, a static page calling the node's HTTP API
+//
+//go:embed ui
+var uiFiles embed.FS
+
+func uiHandler() http.HandlerFunc {
+	files, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.StripPrefix(endpointUI, http.FileServer(http.FS(files))).ServeHTTP
+}
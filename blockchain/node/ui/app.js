@@ -0,0 +1,146 @@
+"use strict";
+
+// the UI is served by the node it talks to, so the API is on the same origin
+const recentBlocks = 10;
+const refreshInterval = 10000;
+const zeroHash = "0".repeat(64);
+
+async function api(path, options) {
+  const res = await fetch(path, options);
+  const body = res.status === 204 ? null : await res.json();
+
+  if (!res.ok && !(body && "results" in body)) {
+    throw new Error((body && body.error) || res.statusText);
+  }
+
+  return body;
+}
+
+async function rpc(calls) {
+  const batch = calls.map((call, i) => ({ jsonrpc: "2.0", id: i, method: call.method, params: call.params }));
+  const res = await api("/rpc", { method: "POST", headers: { "Content-Type": "application/json" }, body: JSON.stringify(batch) });
+
+  return res.sort((a, b) => a.id - b.id);
+}
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  if (className) {
+    td.className = className;
+  }
+
+  return td;
+}
+
+function fillRows(id, rows) {
+  const tbody = document.getElementById(id);
+  tbody.replaceChildren(...rows.map((cells) => {
+    const tr = document.createElement("tr");
+    tr.append(...cells);
+    return tr;
+  }));
+}
+
+async function refreshStatus() {
+  const status = await api("/node/status");
+  const peers = Object.entries(status.peers_known || {});
+
+  document.getElementById("status-number").textContent = status.block_number;
+  document.getElementById("status-hash").textContent = status.block_hash;
+  document.getElementById("status-peers").textContent = peers.length;
+
+  fillRows("peers-rows", peers.map(([address, peer]) => [cell(address), cell(peer.is_bootstrap ? "yes" : "no")]));
+
+  return status;
+}
+
+async function refreshBlocks(status) {
+  if (status.block_hash === zeroHash) {
+    fillRows("blocks-rows", []);
+    return;
+  }
+
+  const calls = [];
+  for (let number = status.block_number; number >= 0 && calls.length < recentBlocks; number--) {
+    calls.push({ method: "chain_getBlock", params: { number: number } });
+  }
+
+  const blocks = (await rpc(calls)).filter((res) => res.result).map((res) => res.result);
+
+  fillRows("blocks-rows", blocks.map((b) => [
+    cell(b.block.header.number),
+    cell(b.hash.slice(0, 16) + "…", "hash"),
+    cell(new Date(b.block.header.time * 1000).toLocaleString()),
+    cell((b.block.payload || []).length, "amount"),
+  ]));
+}
+
+async function refreshBalances() {
+  const balances = await api("/balances/list?sort=amount&order=desc");
+
+  document.getElementById("status-supply").textContent = balances.total_supply + " TBB in " + balances.account_count + " accounts";
+
+  fillRows("balances-rows", balances.accounts.map((b) => [cell(b.account), cell(b.balance, "amount")]));
+}
+
+async function refresh() {
+  try {
+    const status = await refreshStatus();
+    await Promise.all([refreshBlocks(status), refreshBalances()]);
+    document.getElementById("refreshed").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (err) {
+    document.getElementById("refreshed").textContent = "Node unreachable: " + err.message;
+  }
+}
+
+function showResult(text, ok) {
+  const result = document.getElementById("tx-result");
+  result.textContent = text;
+  result.className = ok ? "success" : "error";
+}
+
+// the transfer is simulated first, to tell why it would fail without submitting it
+async function submitTx(event) {
+  event.preventDefault();
+
+  const form = event.target;
+  const tx = {
+    from: form.from.value.trim(),
+    to: form.to.value.trim(),
+    value: parseInt(form.value.value, 10),
+    data: form.data.value,
+  };
+
+  const headers = { "Content-Type": "application/json" };
+  if (form.token.value) {
+    headers["Authorization"] = "Bearer " + form.token.value;
+  }
+
+  const button = form.querySelector("button");
+  button.disabled = true;
+
+  try {
+    const simulation = await api("/tx/simulate", { method: "POST", headers: headers, body: JSON.stringify({ txs: [tx] }) });
+    if (!simulation.valid) {
+      showResult("This will fail: " + simulation.results[0].error, false);
+      return;
+    }
+
+    const res = await api("/tx/add", { method: "POST", headers: headers, body: JSON.stringify(tx) });
+    showResult("Sent " + tx.value + " TBB to " + tx.to + " in block " + res.block_hash.slice(0, 16) + "…", true);
+    form.value.value = "";
+    form.data.value = "";
+
+    await refresh();
+  } catch (err) {
+    showResult("The transfer failed: " + err.message, false);
+  } finally {
+    button.disabled = false;
+  }
+}
+
+document.getElementById("tx-form").addEventListener("submit", submitTx);
+
+refresh();
+setInterval(refresh, refreshInterval);
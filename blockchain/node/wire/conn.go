@@ -0,0 +1,268 @@
+package wire
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+// Credentials presented by a client when it connects
+type Credentials struct {
+	Token      string
+	HMACSecret []byte
+}
+
+// Conn is a client connection to the TCP transport of a node. It is safe for concurrent use,
+// requests are sent as soon as they are made and their responses read as they arrive
+type Conn struct {
+	addr string
+	conn net.Conn
+
+	// Authenticated is whether the node accepted the credentials
+	Authenticated bool
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   uint32
+	pending  map[uint32]chan Frame
+	lastUsed time.Time
+	err      error
+	done     chan struct{}
+}
+
+// Dial connects to the node listening on addr, over TLS when tlsConfig is set, and authenticates with creds
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config, creds Credentials) (*Conn, error) {
+	var conn net.Conn
+	var err error
+
+	if tlsConfig != nil {
+		dialer := tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		addr:     addr,
+		conn:     conn,
+		pending:  make(map[uint32]chan Frame),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	err = c.authenticate(ctx, creds)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+// authenticate answers the challenge of the node before the connection carries any request
+func (c *Conn) authenticate(ctx context.Context, creds Credentials) error {
+	deadline, ok := ctx.Deadline()
+	if ok {
+		c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	frame, err := ReadFrame(c.conn, MaxFrameSize)
+	if err != nil {
+		return err
+	}
+
+	hello := Hello{}
+	if frame.Op != OpHello || Decode(frame.Payload, &hello) != nil {
+		return fmt.Errorf("%s didn't start with a hello frame", c.addr)
+	}
+
+	if hello.Version != Version {
+		return fmt.Errorf("%s speaks version %d of the wire protocol, version %d is expected", c.addr, hello.Version, Version)
+	}
+
+	auth := Auth{Token: creds.Token}
+	if len(creds.HMACSecret) > 0 {
+		auth.Signature = Sign(hello.Challenge, creds.HMACSecret)
+	}
+
+	payload, err := Encode(auth)
+	if err != nil {
+		return err
+	}
+
+	err = WriteFrame(c.conn, Frame{Op: OpAuth, Payload: payload})
+	if err != nil {
+		return err
+	}
+
+	frame, err = ReadFrame(c.conn, MaxFrameSize)
+	if err != nil {
+		return err
+	}
+
+	res := AuthRes{}
+	if frame.Op != OpResult || Decode(frame.Payload, &res) != nil {
+		return fmt.Errorf("%s didn't answer the credentials", c.addr)
+	}
+
+	c.Authenticated = res.Authenticated
+
+	return nil
+}
+
+// Call sends the request of op with req as payload, nil for none, and decodes the result into res.
+// It fails with the errors of the HTTP client: *client.APIError, *client.ConnError or *client.DecodeError
+func (c *Conn) Call(ctx context.Context, op Op, req interface{}, res interface{}) error {
+	endpoint := op.Endpoint()
+
+	var payload []byte
+	if req != nil {
+		var err error
+		payload, err = Encode(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	responses := make(chan Frame, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return &client.ConnError{Endpoint: endpoint, Err: err}
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = responses
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	err := c.write(ctx, Frame{ID: id, Op: op, Payload: payload})
+	if err != nil {
+		c.fail(err)
+		return &client.ConnError{Endpoint: endpoint, Err: err}
+	}
+
+	var frame Frame
+	select {
+	case frame = <-responses:
+	case <-c.done:
+		return &client.ConnError{Endpoint: endpoint, Err: c.Err()}
+	case <-ctx.Done():
+		return &client.ConnError{Endpoint: endpoint, Err: ctx.Err()}
+	}
+
+	if frame.Op == OpError {
+		errRes := Error{}
+		err = Decode(frame.Payload, &errRes)
+		if err != nil {
+			return &client.DecodeError{Endpoint: endpoint, Err: err}
+		}
+
+		return &client.APIError{Endpoint: endpoint, StatusCode: errRes.Code, Message: errRes.Message}
+	}
+
+	if frame.Op != OpResult {
+		return &client.DecodeError{Endpoint: endpoint, Err: fmt.Errorf("unexpected %s frame", frame.Op)}
+	}
+
+	err = Decode(frame.Payload, res)
+	if err != nil {
+		return &client.DecodeError{Endpoint: endpoint, Err: err}
+	}
+
+	return nil
+}
+
+func (c *Conn) write(ctx context.Context, f Frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	c.conn.SetWriteDeadline(deadline)
+
+	return WriteFrame(c.conn, f)
+}
+
+// readLoop hands every response to the request waiting for it, until the connection breaks
+func (c *Conn) readLoop() {
+	for {
+		frame, err := ReadFrame(c.conn, MaxFrameSize)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		responses, ok := c.pending[frame.ID]
+		c.mu.Unlock()
+
+		// the request may have timed out meanwhile, and a misbehaving node may answer twice
+		if ok {
+			select {
+			case responses <- frame:
+			default:
+			}
+		}
+	}
+}
+
+// fail closes the connection and wakes up the requests waiting on it
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	c.conn.Close()
+	close(c.done)
+}
+
+// Err is why the connection broke, nil while it is usable
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// IdleSince is when the last request was made
+func (c *Conn) IdleSince() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastUsed
+}
+
+func (c *Conn) Close() error {
+	c.fail(errors.New("connection closed"))
+
+	return nil
+}
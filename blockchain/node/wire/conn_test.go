@@ -0,0 +1,218 @@
+package wire
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+)
+
+// testServer accepts a single connection, greets it with a hello frame and accepts any credentials,
+// then hands every request frame to serve, which writes the responses to conn
+func testServer(t *testing.T, serve func(conn net.Conn, requests <-chan Frame)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		hello, _ := Encode(Hello{Version: Version, Challenge: []byte("challenge")})
+		if WriteFrame(conn, Frame{Op: OpHello, Payload: hello}) != nil {
+			return
+		}
+
+		frame, err := ReadFrame(conn, MaxFrameSize)
+		if err != nil || frame.Op != OpAuth {
+			return
+		}
+
+		auth := Auth{}
+		Decode(frame.Payload, &auth)
+
+		res, _ := Encode(AuthRes{Authenticated: auth.Token == "token"})
+		if WriteFrame(conn, Frame{Op: OpResult, Payload: res}) != nil {
+			return
+		}
+
+		requests := make(chan Frame)
+		go func() {
+			defer close(requests)
+
+			for {
+				frame, err := ReadFrame(conn, MaxFrameSize)
+				if err != nil {
+					return
+				}
+
+				requests <- frame
+			}
+		}()
+
+		serve(conn, requests)
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestConnMultiplexesRequests(t *testing.T) {
+	const calls = 8
+
+	addr := testServer(t, func(conn net.Conn, requests <-chan Frame) {
+		// every request is answered once all of them arrived, in reverse order, after an answer to no request
+		frames := make([]Frame, 0, calls)
+		for frame := range requests {
+			frames = append(frames, frame)
+			if len(frames) == calls {
+				break
+			}
+		}
+
+		WriteFrame(conn, Frame{ID: 1 << 31, Op: OpResult})
+
+		for i := len(frames) - 1; i >= 0; i-- {
+			req := BlocksReq{}
+			Decode(frames[i].Payload, &req)
+
+			if req.FromNumber%2 == 1 {
+				payload, _ := Encode(Error{Code: http.StatusTooManyRequests, Message: "too many requests"})
+				WriteFrame(conn, Frame{ID: frames[i].ID, Op: OpError, Payload: payload})
+				continue
+			}
+
+			payload, _ := Encode(req)
+			WriteFrame(conn, Frame{ID: frames[i].ID, Op: OpResult, Payload: payload})
+		}
+
+		for range requests {
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, addr, nil, Credentials{Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if !conn.Authenticated {
+		t.Error("the credentials weren't accepted")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i uint64) {
+			defer wg.Done()
+
+			res := BlocksReq{}
+			err := conn.Call(ctx, OpBlocks, BlocksReq{FromNumber: i, Limit: 100}, &res)
+
+			if i%2 == 1 {
+				var apiErr *client.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+					t.Errorf("call %d failed with %v, want a %d API error", i, err, http.StatusTooManyRequests)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("call %d: %s", i, err)
+				return
+			}
+
+			if res.FromNumber != i {
+				t.Errorf("call %d got the response of call %d", i, res.FromNumber)
+			}
+		}(uint64(i))
+	}
+
+	wg.Wait()
+}
+
+func TestConnFailsOnOversizedFrame(t *testing.T) {
+	addr := testServer(t, func(conn net.Conn, requests <-chan Frame) {
+		<-requests
+
+		header := make([]byte, 4+headerSize)
+		binary.BigEndian.PutUint32(header, MaxFrameSize+1)
+		conn.Write(header)
+
+		for range requests {
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, addr, nil, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if conn.Authenticated {
+		t.Error("a client without credentials was authenticated")
+	}
+
+	err = conn.Call(ctx, OpStatus, nil, &struct{}{})
+
+	var connErr *client.ConnError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("the call failed with %v, want a connection error", err)
+	}
+
+	if conn.Err() == nil {
+		t.Error("the connection is still usable after an oversized frame")
+	}
+
+	err = conn.Call(ctx, OpStatus, nil, &struct{}{})
+	if !errors.As(err, &connErr) {
+		t.Errorf("a call on the broken connection failed with %v, want a connection error", err)
+	}
+}
+
+func TestConnFailsOnTruncatedFrame(t *testing.T) {
+	addr := testServer(t, func(conn net.Conn, requests <-chan Frame) {
+		frame := <-requests
+
+		// the frame announces a payload of 100 bytes, the connection is closed after 3
+		header := make([]byte, 4+headerSize)
+		binary.BigEndian.PutUint32(header, headerSize+100)
+		binary.BigEndian.PutUint32(header[4:], frame.ID)
+		header[8] = byte(OpResult)
+		conn.Write(append(header, 1, 2, 3))
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, addr, nil, Credentials{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Call(ctx, OpStatus, nil, &struct{}{})
+
+	var connErr *client.ConnError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("the call failed with %v, want a connection error", err)
+	}
+}
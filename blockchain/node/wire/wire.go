@@ -0,0 +1,194 @@
+// Package wire is the binary protocol of the TCP transport between TBB nodes.
+//
+// A connection carries frames: a 4 bytes big-endian length of the rest of the frame, a 4 bytes request ID,
+// a 1 byte op and a gob encoded payload. Requests sent at once are told apart by their ID, the response to a
+// request carries the same ID and either OpResult or OpError. Right after accepting a connection the server
+// sends an OpHello frame with a challenge, which the client answers with an OpAuth frame before any request
+package wire
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+// Version of the framing, sent in the hello frame
+const Version = uint(1)
+
+// MaxFrameSize bounds the frames a client reads, servers bound requests with their own limit
+const MaxFrameSize = 64 << 20
+
+// Size of the frame header after the length: request ID and op
+const headerSize = 5
+
+type Op byte
+
+const (
+	OpHello Op = iota + 1
+	OpAuth
+	OpStatus
+	OpHeaders
+	OpBlocks
+	OpBlockAnnounce
+	OpTxAnnounce
+
+	OpResult Op = 0x80
+	OpError  Op = 0x81
+)
+
+// Endpoint is the HTTP route serving the same request as op, so both transports share policies and rate limits
+func (op Op) Endpoint() string {
+	switch op {
+	case OpStatus:
+		return client.EndpointStatus
+	case OpHeaders:
+		return client.EndpointHeaders
+	case OpBlocks:
+		return client.EndpointBlocks
+	case OpBlockAnnounce:
+		return client.EndpointBlock
+	case OpTxAnnounce:
+		return client.EndpointTx
+	}
+
+	return ""
+}
+
+func (op Op) String() string {
+	switch op {
+	case OpHello:
+		return "hello"
+	case OpAuth:
+		return "auth"
+	case OpResult:
+		return "result"
+	case OpError:
+		return "error"
+	}
+
+	if endpoint := op.Endpoint(); endpoint != "" {
+		return endpoint
+	}
+
+	return fmt.Sprintf("op %d", byte(op))
+}
+
+type Frame struct {
+	ID      uint32
+	Op      Op
+	Payload []byte
+}
+
+// Hello is sent by the server when it accepts a connection
+type Hello struct {
+	Version   uint
+	Challenge []byte
+}
+
+// Auth holds the credentials of the client: an API token, and or the HMAC of the challenge with the shared secret
+type Auth struct {
+	Token     string
+	Signature string
+}
+
+// AuthRes tells the client whether its credentials were accepted. Without them only the public ops are served
+type AuthRes struct {
+	Authenticated bool
+}
+
+type HeadersReq struct {
+	FromBlock database.Hash
+	Limit     int
+}
+
+type BlocksReq struct {
+	FromNumber uint64
+	Limit      int
+}
+
+// Error is the payload of OpError, Code being the HTTP status code the same request would have been answered with
+type Error struct {
+	Code    int
+	Message string
+}
+
+// ReadFrame reads the next frame from r, failing on frames larger than max bytes
+func ReadFrame(r io.Reader, max int) (Frame, error) {
+	var header [4 + headerSize]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return Frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < headerSize || int64(length) > int64(max) {
+		return Frame{}, fmt.Errorf("invalid frame of %d bytes, at most %d are accepted", length, max)
+	}
+
+	frame := Frame{
+		ID:      binary.BigEndian.Uint32(header[4:8]),
+		Op:      Op(header[8]),
+		Payload: make([]byte, length-headerSize),
+	}
+
+	_, err = io.ReadFull(r, frame.Payload)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	return frame, nil
+}
+
+// WriteFrame writes f in a single call, so frames written under a lock never interleave
+func WriteFrame(w io.Writer, f Frame) error {
+	buf := make([]byte, 4+headerSize+len(f.Payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(headerSize+len(f.Payload)))
+	binary.BigEndian.PutUint32(buf[4:8], f.ID)
+	buf[8] = byte(f.Op)
+	copy(buf[4+headerSize:], f.Payload)
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+// Encode gob encodes v as the payload of a frame. Each payload is self-contained,
+// so requests answered out of order still decode
+func Encode(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func Decode(payload []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(v)
+}
+
+// Sign is the hex encoded HMAC-SHA256 of the challenge with the secret shared by the nodes of a network
+func Sign(challenge []byte, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature of the challenge
+func VerifySignature(challenge []byte, secret []byte, signature string) error {
+	if !hmac.Equal([]byte(signature), []byte(Sign(challenge, secret))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
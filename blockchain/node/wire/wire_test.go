@@ -0,0 +1,138 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	database "github.com/mycicle/MyChain/blockchain/src"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []Frame{
+		{ID: 0, Op: OpHello, Payload: []byte{}},
+		{ID: 1, Op: OpStatus, Payload: []byte{}},
+		{ID: 42, Op: OpResult, Payload: []byte("payload")},
+		{ID: 1<<32 - 1, Op: OpError, Payload: bytes.Repeat([]byte{0xff}, 1<<16)},
+	}
+
+	// the frames are read back from a single stream, as they are on a connection
+	buf := bytes.Buffer{}
+	for _, f := range frames {
+		err := WriteFrame(&buf, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range frames {
+		got, err := ReadFrame(&buf, MaxFrameSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("read frame %d %s of %d bytes, want frame %d %s of %d bytes", got.ID, got.Op, len(got.Payload), want.ID, want.Op, len(want.Payload))
+		}
+	}
+
+	_, err := ReadFrame(&buf, MaxFrameSize)
+	if err != io.EOF {
+		t.Errorf("reading past the last frame failed with %v, want io.EOF", err)
+	}
+}
+
+func rawFrame(length uint32, rest []byte) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, length)
+
+	return append(header, rest...)
+}
+
+func TestReadInvalidFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+		max  int
+		err  error
+	}{
+		{name: "truncated length", raw: []byte{0, 0}, max: MaxFrameSize, err: io.ErrUnexpectedEOF},
+		{name: "truncated header", raw: rawFrame(10, []byte{0, 0, 0, 1}), max: MaxFrameSize, err: io.ErrUnexpectedEOF},
+		{name: "truncated payload", raw: rawFrame(headerSize+10, []byte{0, 0, 0, 1, byte(OpStatus), 1, 2, 3}), max: MaxFrameSize, err: io.ErrUnexpectedEOF},
+		{name: "shorter than its header", raw: rawFrame(headerSize-1, []byte{0, 0, 0, 1, byte(OpStatus)}), max: MaxFrameSize},
+		{name: "larger than the max", raw: rawFrame(headerSize+11, []byte{0, 0, 0, 1, byte(OpStatus)}), max: headerSize + 10},
+		{name: "larger than MaxFrameSize", raw: rawFrame(MaxFrameSize+1, []byte{0, 0, 0, 1, byte(OpStatus)}), max: MaxFrameSize},
+	}
+
+	for _, test := range tests {
+		_, err := ReadFrame(bytes.NewReader(test.raw), test.max)
+		if err == nil {
+			t.Errorf("%s: the frame was read", test.name)
+			continue
+		}
+
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%s: failed with %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	txs := []database.Tx{
+		database.NewTx("andrej", "babayaga", 10, ""),
+		database.NewTx("andrej", "andrej", 100, "reward"),
+	}
+
+	block := database.NewBlock(database.Hash{1, 2, 3}, 7, 1600000000, txs)
+	blockHash, err := block.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []struct {
+		name string
+		in   interface{}
+		out  interface{}
+	}{
+		{name: "tx", in: txs[0], out: &database.Tx{}},
+		{name: "block", in: block, out: &database.Block{}},
+		{name: "block fs", in: database.BlockFS{Key: blockHash, Value: block}, out: &database.BlockFS{}},
+		{name: "headers request", in: HeadersReq{FromBlock: blockHash, Limit: 500}, out: &HeadersReq{}},
+		{name: "blocks request", in: BlocksReq{FromNumber: 7, Limit: 100}, out: &BlocksReq{}},
+		{name: "error", in: Error{Code: 429, Message: "too many requests"}, out: &Error{}},
+	}
+
+	for _, v := range values {
+		payload, err := Encode(v.in)
+		if err != nil {
+			t.Fatalf("%s: %s", v.name, err)
+		}
+
+		err = Decode(payload, v.out)
+		if err != nil {
+			t.Fatalf("%s: %s", v.name, err)
+		}
+
+		if got := reflect.ValueOf(v.out).Elem().Interface(); !reflect.DeepEqual(got, v.in) {
+			t.Errorf("%s: decoded %+v, want %+v", v.name, got, v.in)
+		}
+	}
+
+	// a block must hash the same once decoded, or it would fail the header checks
+	decoded := database.Block{}
+	payload, _ := Encode(block)
+	Decode(payload, &decoded)
+
+	decodedHash, err := decoded.Hash()
+	if err != nil || decodedHash != blockHash {
+		t.Errorf("the decoded block hashes to %x, want %x", decodedHash, blockHash)
+	}
+
+	err = Decode([]byte("not gob"), &database.Block{})
+	if err == nil {
+		t.Error("a malformed payload was decoded")
+	}
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const SortByName = "name"
+const SortByAmount = "amount"
+
+// BalancesQuery selects, orders and pages the balances of a state
+type BalancesQuery struct {
+	// SortByName or SortByAmount, accounts of equal amount being sorted by name. Defaults to SortByName
+	SortBy string
+	Desc   bool
+
+	// Maximum number of balances in a page, 0 for all of them
+	Limit int
+
+	// NextCursor of the previous page, empty for the first page
+	Cursor string
+
+	// Balances strictly below MinBalance are left out
+	MinBalance uint
+
+	// Only lists these accounts, including the ones without any balance yet. All accounts when empty
+	Accounts []Account
+}
+
+type AccountBalance struct {
+	Account Account `json:"account"`
+	Balance uint    `json:"balance"`
+}
+
+type BalancesPage struct {
+	Balances []AccountBalance
+
+	// Cursor to query the next page with, empty on the last page
+	NextCursor string
+
+	// Number of balances matching the query, on every page
+	Matched int
+
+	// Number of accounts and sum of their balances in the whole state
+	AccountCount int
+	TotalSupply  uint
+}
+
+// QueryBalances returns the page of balances matching q
+func QueryBalances(balances map[Account]uint, q BalancesQuery) (BalancesPage, error) {
+	if q.SortBy == "" {
+		q.SortBy = SortByName
+	}
+	if q.SortBy != SortByName && q.SortBy != SortByAmount {
+		return BalancesPage{}, fmt.Errorf("invalid sort '%s', expected '%s' or '%s'", q.SortBy, SortByName, SortByAmount)
+	}
+	if q.Limit < 0 {
+		return BalancesPage{}, fmt.Errorf("invalid limit %d", q.Limit)
+	}
+
+	page := BalancesPage{Balances: make([]AccountBalance, 0), AccountCount: len(balances)}
+	for _, balance := range balances {
+		page.TotalSupply += balance
+	}
+
+	selected := make([]AccountBalance, 0, len(balances))
+	if len(q.Accounts) > 0 {
+		seen := make(map[Account]bool)
+		for _, account := range q.Accounts {
+			if !seen[account] {
+				seen[account] = true
+				selected = append(selected, AccountBalance{Account: account, Balance: balances[account]})
+			}
+		}
+	} else {
+		for account, balance := range balances {
+			selected = append(selected, AccountBalance{Account: account, Balance: balance})
+		}
+	}
+
+	matching := selected[:0]
+	for _, b := range selected {
+		if b.Balance >= q.MinBalance {
+			matching = append(matching, b)
+		}
+	}
+
+	less := func(a, b AccountBalance) bool {
+		if q.SortBy == SortByAmount && a.Balance != b.Balance {
+			return a.Balance < b.Balance
+		}
+
+		return a.Account < b.Account
+	}
+	if q.Desc {
+		asc := less
+		less = func(a, b AccountBalance) bool {
+			return asc(b, a)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return less(matching[i], matching[j])
+	})
+
+	page.Matched = len(matching)
+
+	start := 0
+	if q.Cursor != "" {
+		after, err := decodeBalancesCursor(q.Cursor)
+		if err != nil {
+			return BalancesPage{}, err
+		}
+
+		start = sort.Search(len(matching), func(i int) bool {
+			return less(after, matching[i])
+		})
+	}
+
+	end := len(matching)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		page.NextCursor = encodeBalancesCursor(matching[end-1])
+	}
+
+	page.Balances = append(page.Balances, matching[start:end]...)
+
+	return page, nil
+}
+
+// the cursor is the last balance of a page, the next page starting right after it in the sort order
+func encodeBalancesCursor(b AccountBalance) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", b.Balance, b.Account)))
+}
+
+func decodeBalancesCursor(cursor string) (AccountBalance, error) {
+	invalid := fmt.Errorf("invalid cursor '%s'", cursor)
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return AccountBalance{}, invalid
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return AccountBalance{}, invalid
+	}
+
+	balance, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return AccountBalance{}, invalid
+	}
+
+	return AccountBalance{Account: Account(parts[1]), Balance: uint(balance)}, nil
+}
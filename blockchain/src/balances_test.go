@@ -0,0 +1,128 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryBalancesPages(t *testing.T) {
+	balances := map[Account]uint{
+		"andrej":   100,
+		"babayaga": 50,
+		"caesar":   50,
+		"dracula":  0,
+		"elsa":     7,
+	}
+
+	tests := []struct {
+		name  string
+		query BalancesQuery
+		pages [][]Account
+	}{
+		{
+			name:  "by name",
+			query: BalancesQuery{Limit: 2},
+			pages: [][]Account{{"andrej", "babayaga"}, {"caesar", "dracula"}, {"elsa"}},
+		},
+		{
+			name:  "by amount, ties by name",
+			query: BalancesQuery{SortBy: SortByAmount, Desc: true, Limit: 2},
+			pages: [][]Account{{"andrej", "caesar"}, {"babayaga", "elsa"}, {"dracula"}},
+		},
+		{
+			name:  "limit of every balance",
+			query: BalancesQuery{Limit: 5},
+			pages: [][]Account{{"andrej", "babayaga", "caesar", "dracula", "elsa"}},
+		},
+		{
+			name:  "no limit",
+			query: BalancesQuery{Desc: true},
+			pages: [][]Account{{"elsa", "dracula", "caesar", "babayaga", "andrej"}},
+		},
+		{
+			name:  "min balance",
+			query: BalancesQuery{SortBy: SortByAmount, MinBalance: 50, Limit: 1},
+			pages: [][]Account{{"babayaga"}, {"caesar"}, {"andrej"}},
+		},
+		{
+			name:  "nothing matches",
+			query: BalancesQuery{MinBalance: 1000, Limit: 2},
+			pages: [][]Account{{}},
+		},
+		{
+			name:  "listed accounts",
+			query: BalancesQuery{Accounts: []Account{"elsa", "nobody", "elsa"}, Limit: 1},
+			pages: [][]Account{{"elsa"}, {"nobody"}},
+		},
+	}
+
+	for _, test := range tests {
+		q := test.query
+		matched := 0
+		for _, page := range test.pages {
+			matched += len(page)
+		}
+
+		for i, want := range test.pages {
+			page, err := QueryBalances(balances, q)
+			if err != nil {
+				t.Fatalf("%s, page %d: %s", test.name, i, err)
+			}
+
+			got := make([]Account, 0, len(page.Balances))
+			for _, b := range page.Balances {
+				got = append(got, b.Account)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s, page %d: got %v, want %v", test.name, i, got, want)
+			}
+
+			if last := i == len(test.pages)-1; last != (page.NextCursor == "") {
+				t.Errorf("%s, page %d: next cursor %q on page %d of %d", test.name, i, page.NextCursor, i+1, len(test.pages))
+			}
+
+			if page.Matched != matched || page.AccountCount != len(balances) || page.TotalSupply != 207 {
+				t.Errorf("%s, page %d: matched %d of %d accounts holding %d, want %d of %d holding 207", test.name, i, page.Matched, page.AccountCount, page.TotalSupply, matched, len(balances))
+			}
+
+			q.Cursor = page.NextCursor
+		}
+	}
+}
+
+func TestQueryBalancesPastLastPage(t *testing.T) {
+	balances := map[Account]uint{"andrej": 100, "babayaga": 50}
+
+	// the cursor of the last balance, or past it once the account is gone, leads to an empty page
+	for _, cursor := range []AccountBalance{{Account: "babayaga", Balance: 50}, {Account: "zorro", Balance: 1}} {
+		page, err := QueryBalances(balances, BalancesQuery{Limit: 1, Cursor: encodeBalancesCursor(cursor)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(page.Balances) != 0 || page.NextCursor != "" {
+			t.Errorf("after %s: got %v and cursor %q, want an empty last page", cursor.Account, page.Balances, page.NextCursor)
+		}
+	}
+}
+
+func TestQueryBalancesInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query BalancesQuery
+	}{
+		{name: "cursor not base64", query: BalancesQuery{Cursor: "not a cursor!"}},
+		{name: "cursor without separator", query: BalancesQuery{Cursor: "YW5kcmVq"}},
+		{name: "cursor without amount", query: BalancesQuery{Cursor: "eDphbmRyZWo"}},
+		{name: "sort", query: BalancesQuery{SortBy: "age"}},
+		{name: "negative limit", query: BalancesQuery{Limit: -1}},
+	}
+
+	for _, test := range tests {
+		_, err := QueryBalances(map[Account]uint{"andrej": 100}, test.query)
+		if err == nil {
+			t.Errorf("%s: the query didn't fail", test.name)
+		}
+	}
+}
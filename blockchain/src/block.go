@@ -3,6 +3,7 @@ package database
 import (
 	"bytes"
 	"crypto/sha256"
+	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 )
@@ -24,6 +25,41 @@ type Block struct {
 	TXs    []Tx        `json:"payload"` // new transactions only (payload)
 }
 
+// blockGob is how a Block is gob encoded, e.g. between nodes speaking the TCP transport. Gob decodes
+// an empty list of txs as nil, which marshals, and so hashes, as null instead of []
+type blockGob struct {
+	Header BlockHeader
+	TXs    []Tx
+	NoTXs  bool
+}
+
+func (b Block) GobEncode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(blockGob{
+		Header: b.Header,
+		TXs:    b.TXs,
+		NoTXs:  b.TXs != nil && len(b.TXs) == 0,
+	})
+
+	return buf.Bytes(), err
+}
+
+func (b *Block) GobDecode(data []byte) error {
+	decoded := blockGob{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded)
+	if err != nil {
+		return err
+	}
+
+	b.Header = decoded.Header
+	b.TXs = decoded.TXs
+	if decoded.NoTXs {
+		b.TXs = []Tx{}
+	}
+
+	return nil
+}
+
 type BlockHeader struct {
 	Parent Hash   `json:"parent"` // parent block reference
 	Number uint64 `json:"number"`
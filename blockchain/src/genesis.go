@@ -1,6 +1,7 @@
 package database
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"io/ioutil"
 )
@@ -16,9 +17,21 @@ const genesisJson = `
 `
 
 type genesis struct {
+	Time     string           `json:"genesis_time"`
+	ChainID  string           `json:"chain_id"`
 	Balances map[Account]uint `json:"balances"`
 }
 
+// Hash identifies the genesis by its content, whatever the formatting of genesis.json
+func (g genesis) Hash() (Hash, error) {
+	genesisJson, err := json.Marshal(g)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(genesisJson), nil
+}
+
 func loadGenesis(path string) (genesis, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -3,23 +3,45 @@ package database
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // state is the database component responsible for encapsulating all business logic
 // it will know all user balances and who transfered TBB tokens to whom, and how many were transferred
+// it is safe for concurrent use: queries read copies and commits are serialized
 type State struct {
-	Balances        map[Account]uint
+	mu sync.RWMutex
+
+	balances        map[Account]uint
 	txMempool       []Tx
+	committedTxs    map[Hash]committedTx
+	committedPrune  time.Time
 	latestBlockHash Hash
 	latestBlock     Block
 	hasGenesisBlock bool
 
+	// identify the chain, so nodes of different chains don't sync with each other
+	chainID     string
+	genesisHash Hash
+
 	dbFile    *os.File
 	cacheFile *os.File
+
+	// a read-only state doesn't accept blocks and leaves the state.json untouched on Close
+	readOnly bool
+
+	// counters of what AddBlock committed since the state was loaded, read by the node metrics
+	blocksApplied uint64
+	txsApplied    uint64
+
+	blockListeners []func(BlockFS)
 }
 
 // it is contstructed using the initial balances from the genesis.json file
@@ -29,36 +51,65 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 		return nil, err
 	}
 
+	return newStateFromDisk(dataDir, false)
+}
+
+// NewStateFromDiskReadOnly loads the state without writing anything to the data dir, for the commands
+// only querying it. The data dir must already exist
+func NewStateFromDiskReadOnly(dataDir string) (*State, error) {
+	return newStateFromDisk(dataDir, true)
+}
+
+func newStateFromDisk(dataDir string, readOnly bool) (*State, error) {
 	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
 	if err != nil {
 		return nil, err
 	}
 
+	genesisHash, err := gen.Hash()
+	if err != nil {
+		return nil, err
+	}
+
 	balances := make(map[Account]uint)
 	for account, balance := range gen.Balances {
 		balances[account] = balance
 	}
 
-	dbf, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		return nil, err
-	}
+	var dbf *os.File
+	var cf *os.File
 
-	cf, err := os.OpenFile(getStateJsonFilePath(dataDir), os.O_RDWR|os.O_CREATE, 0600)
-	if err != nil {
-		return nil, err
+	if readOnly {
+		dbf, err = os.Open(getBlocksDbFilePath(dataDir))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		dbf, err = os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		cf, err = os.OpenFile(getStateJsonFilePath(dataDir), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	scanner := bufio.NewScanner(dbf)
 
 	state := &State{
-		Balances:        balances,
+		balances:        balances,
 		txMempool:       make([]Tx, 0),
+		committedTxs:    make(map[Hash]committedTx),
 		latestBlockHash: Hash{},
 		latestBlock:     Block{},
 		hasGenesisBlock: false,
+		chainID:         gen.ChainID,
+		genesisHash:     genesisHash,
 		dbFile:          dbf,
 		cacheFile:       cf,
+		readOnly:        readOnly,
 	}
 
 	for scanner.Scan() {
@@ -82,6 +133,7 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 			return nil, err
 		}
 
+		state.recordCommittedTxs(blockFs.Key, blockFs.Value)
 		state.latestBlockHash = blockFs.Key
 		state.latestBlock = blockFs.Value
 		state.hasGenesisBlock = true
@@ -92,6 +144,13 @@ func NewStateFromDisk(dataDir string) (*State, error) {
 
 // Get the next block number
 func (state *State) NextBlockNumber() uint64 {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	return state.nextBlockNumber()
+}
+
+func (state *State) nextBlockNumber() uint64 {
 	if !state.hasGenesisBlock {
 		return uint64(0)
 	}
@@ -101,11 +160,90 @@ func (state *State) NextBlockNumber() uint64 {
 
 // Adding new blocks to the mempool
 func (s *State) AddBlock(b Block) (Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addBlock(b)
+}
+
+// AppendBlock wraps txs into the next block on top of the latest one and adds it,
+// so concurrent callers never build two blocks with the same number
+func (s *State) AppendBlock(txs []Tx, time uint64) (Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addBlock(NewBlock(s.latestBlockHash, s.nextBlockNumber(), time, txs))
+}
+
+// ErrBatchRejected is returned by AppendBatch when at least one transaction of the batch is invalid
+var ErrBatchRejected = errors.New("batch rejected, no transaction was committed")
+
+// InvalidBlockError is returned when a block doesn't follow the latest one or holds an invalid tx
+type InvalidBlockError struct {
+	Number uint64
+	Err    error
+}
+
+func (e *InvalidBlockError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InvalidBlockError) Unwrap() error {
+	return e.Err
+}
+
+// AppendBatch validates txs in order, each against the balances left by the previous ones,
+// and wraps them into a single new block only when all of them are valid.
+// The returned slice holds the validation error of each transaction, nil for the valid ones
+func (s *State) AppendBatch(txs []Tx, time uint64) (Hash, []error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, txErrs := validateTxs(txs, s.copy())
+	for _, err := range txErrs {
+		if err != nil {
+			return Hash{}, txErrs, ErrBatchRejected
+		}
+	}
+
+	hash, err := s.addBlock(NewBlock(s.latestBlockHash, s.nextBlockNumber(), time, txs))
+
+	return hash, txErrs, err
+}
+
+// Simulate applies txs onto a copy of the state without persisting anything.
+// It returns the error of each tx and, when they are all valid, how much every account's balance would change by
+func (s *State) Simulate(txs []Tx) (map[Account]int64, []error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pending, txErrs := validateTxs(txs, s.copy())
+	for _, err := range txErrs {
+		if err != nil {
+			return nil, txErrs
+		}
+	}
+
+	deltas := make(map[Account]int64)
+	for account, balance := range pending.balances {
+		if delta := int64(balance) - int64(s.balances[account]); delta != 0 {
+			deltas[account] = delta
+		}
+	}
+
+	return deltas, txErrs
+}
+
+func (s *State) addBlock(b Block) (Hash, error) {
+	if s.readOnly {
+		return Hash{}, fmt.Errorf("the state is read-only, block %d can't be added", b.Header.Number)
+	}
+
 	pendingState := s.copy()
 
 	err := applyBlock(b, pendingState)
 	if err != nil {
-		return Hash{}, err
+		return Hash{}, &InvalidBlockError{Number: b.Header.Number, Err: err}
 	}
 
 	blockHash, err := b.Hash()
@@ -131,14 +269,33 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	s.Balances = pendingState.Balances
+	s.balances = pendingState.balances
 	s.latestBlockHash = blockHash
 	s.latestBlock = b
 	s.hasGenesisBlock = true
 
+	atomic.AddUint64(&s.blocksApplied, 1)
+	atomic.AddUint64(&s.txsApplied, uint64(len(b.TXs)))
+
+	s.recordCommittedTxs(blockHash, b)
+	s.pruneMempool()
+
+	for _, listener := range s.blockListeners {
+		listener(blockFs)
+	}
+
 	return blockHash, nil
 }
 
+// OnBlockAdded calls listener with every block committed from now on, produced locally or synced.
+// The listener is called with the state locked: it must return quickly and not use the state
+func (s *State) OnBlockAdded(listener func(BlockFS)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blockListeners = append(s.blockListeners, listener)
+}
+
 func (s *State) AddBlocks(blocks []Block) error {
 	for _, b := range blocks {
 		_, err := s.AddBlock(b)
@@ -150,77 +307,326 @@ func (s *State) AddBlocks(blocks []Block) error {
 	return nil
 }
 
-// Adding new transactions to the mempool
-func (state *State) AddTx(tx Tx) error {
-	if err := state.apply(tx); err != nil {
+// ErrTxPending is returned by AddTx for a transaction already in the mempool
+var ErrTxPending = errors.New("transaction is already pending")
+
+// ErrTxCommitted is returned by AddTx for a transaction already in a block of the chain
+var ErrTxCommitted = errors.New("transaction is already committed")
+
+// ErrTxExpired is returned by AddTx for a transaction whose time is more than TxMaxAge away from now
+var ErrTxExpired = errors.New("transaction is too old or too far in the future")
+
+// ErrMempoolEmpty is returned by Persist when there is no pending transaction to commit
+var ErrMempoolEmpty = errors.New("no pending transaction to commit")
+
+// The mempool refuses the transactions older than this, so only the transactions committed within it are
+// remembered to refuse them again
+const TxMaxAge = time.Hour
+
+// How often the committed transactions older than TxMaxAge are forgotten
+const committedTxsPruneInterval = time.Minute
+
+type committedTx struct {
+	blockHash Hash
+	time      uint64
+}
+
+// txExpired tells whether tx is more than TxMaxAge away from now
+func txExpired(tx Tx, now time.Time) bool {
+	maxAge := uint64(TxMaxAge)
+	unixNano := uint64(now.UnixNano())
+
+	return tx.Time+maxAge < unixNano || tx.Time > unixNano+maxAge
+}
+
+// AddTx adds tx to the mempool when it is valid after the latest block and the transactions already pending.
+// The balances only change once the mempool is committed by Persist
+func (s *State) AddTx(tx Tx) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		return err
+	}
+
+	if _, committed := s.committedTxs[txHash]; committed {
+		return ErrTxCommitted
+	}
+
+	if txExpired(tx, time.Now()) {
+		return ErrTxExpired
+	}
+
+	for _, pendingTx := range s.txMempool {
+		pendingHash, err := pendingTx.Hash()
+		if err != nil {
+			return err
+		}
+
+		if pendingHash == txHash {
+			return ErrTxPending
+		}
+	}
+
+	pending := s.copy()
+	if err := applyTXs(s.txMempool, pending); err != nil {
+		return err
+	}
+
+	if err := applyTx(tx, pending); err != nil {
 		return err
 	}
 
-	state.txMempool = append(state.txMempool, tx)
+	s.txMempool = append(s.txMempool, tx)
 
 	return nil
 }
 
+// PendingTxs returns a copy of the mempool, in the order the transactions were added
+func (s *State) PendingTxs() []Tx {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append(make([]Tx, 0, len(s.txMempool)), s.txMempool...)
+}
+
+// CommittedTxBlock is the hash of the block which committed the transaction of txHash, as long as the
+// transaction isn't older than TxMaxAge
+func (s *State) CommittedTxBlock(txHash Hash) (Hash, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	committed, ok := s.committedTxs[txHash]
+
+	return committed.blockHash, ok
+}
+
+// recordCommittedTxs remembers the transactions of b not older than TxMaxAge, so they can't be added to the
+// mempool and committed again, and forgets the expired ones. It must be called with the state lock held,
+// once b is committed
+func (s *State) recordCommittedTxs(blockHash Hash, b Block) {
+	now := time.Now()
+
+	for _, tx := range b.TXs {
+		if txExpired(tx, now) {
+			continue
+		}
+
+		if txHash, err := tx.Hash(); err == nil {
+			s.committedTxs[txHash] = committedTx{blockHash: blockHash, time: tx.Time}
+		}
+	}
+
+	if now.Sub(s.committedPrune) < committedTxsPruneInterval {
+		return
+	}
+	s.committedPrune = now
+
+	for txHash, committed := range s.committedTxs {
+		if txExpired(Tx{Time: committed.time}, now) {
+			delete(s.committedTxs, txHash)
+		}
+	}
+}
+
+// pruneMempool drops the pending transactions committed by the latest block, the ones it made invalid and the
+// expired ones, which could be committed without being remembered.
+// It must be called with the state lock held, once the block is committed and recorded
+func (s *State) pruneMempool() {
+	if len(s.txMempool) == 0 {
+		return
+	}
+
+	now := time.Now()
+	pending := s.copy()
+	mempool := make([]Tx, 0, len(s.txMempool))
+	for _, tx := range s.txMempool {
+		txHash, err := tx.Hash()
+		if err != nil {
+			continue
+		}
+		if _, committed := s.committedTxs[txHash]; committed {
+			continue
+		}
+
+		if txExpired(tx, now) {
+			fmt.Printf("Pending TX %x was dropped. %s\n", txHash, ErrTxExpired)
+			continue
+		}
+
+		if err := applyTx(tx, pending); err != nil {
+			fmt.Printf("Pending TX %x was dropped. %s\n", txHash, err)
+			continue
+		}
+
+		mempool = append(mempool, tx)
+	}
+
+	s.txMempool = mempool
+}
+
+// LatestHeader is the header of the latest block along with its hash, empty before the first block
+func (s *State) LatestHeader() HeaderFS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.latestBlockHash.IsEmpty() {
+		return HeaderFS{}
+	}
+
+	return HeaderFS{Key: s.latestBlockHash, Value: s.latestBlock.Header}
+}
+
+// ChainID is the chain id of genesis.json
+func (s *State) ChainID() string {
+	return s.chainID
+}
+
+// GenesisHash is the hash of the content of genesis.json
+func (s *State) GenesisHash() Hash {
+	return s.genesisHash
+}
+
+// Number of blocks committed by AddBlock since the state was loaded
+func (s *State) BlocksApplied() uint64 {
+	return atomic.LoadUint64(&s.blocksApplied)
+}
+
+// Number of transactions committed by AddBlock since the state was loaded
+func (s *State) TxsApplied() uint64 {
+	return atomic.LoadUint64(&s.txsApplied)
+}
+
+func (s *State) MempoolSize() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.txMempool)
+}
+
 func (state *State) LatestBlockHash() Hash {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
 	return state.latestBlockHash
 }
 
 func (s *State) LatestBlock() Block {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlock
 }
 
-// Persisting transactions to disk
+// Balances returns a copy of every account balance at the latest block
+func (s *State) Balances() map[Account]uint {
+	return s.Snapshot().Balances
+}
+
+// Snapshot is a consistent copy of the state at its latest block, safe to read while new blocks are added
+type Snapshot struct {
+	LatestBlockHash Hash
+	LatestBlock     Block
+	Balances        map[Account]uint
+}
+
+func (s *State) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := make(map[Account]uint, len(s.balances))
+	for acc, balance := range s.balances {
+		balances[acc] = balance
+	}
+
+	return Snapshot{
+		LatestBlockHash: s.latestBlockHash,
+		LatestBlock:     s.latestBlock,
+		Balances:        balances,
+	}
+}
+
+// Persist commits the transactions of the mempool in a new block on top of the latest one
 func (state *State) Persist() (Hash, error) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if len(state.txMempool) == 0 {
+		return Hash{}, ErrMempoolEmpty
+	}
+
 	block := NewBlock(
 		state.latestBlockHash,
-		state.latestBlock.Header.Number+1,
+		state.nextBlockNumber(),
 		uint64(time.Now().Unix()),
 		state.txMempool,
 	)
 
-	blockHash, err := block.Hash()
-	if err != nil {
-		return Hash{}, err
+	return state.addBlock(block)
+}
+
+// Close flushes the blocks.db to disk, snapshots the balances into the state.json and closes both files.
+// A read-only state only closes the blocks.db
+func (state *State) Close() error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.readOnly {
+		return state.dbFile.Close()
 	}
 
-	blockFs := BlockFS{
-		Key:   blockHash,
-		Value: block,
+	errs := make([]string, 0)
+
+	if err := state.writeBalancesCache(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := state.cacheFile.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := state.dbFile.Sync(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := state.dbFile.Close(); err != nil {
+		errs = append(errs, err.Error())
 	}
 
-	blockFsJson, err := json.Marshal(blockFs)
-	if err != nil {
-		return Hash{}, err
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to close the state cleanly. %s", strings.Join(errs, ". "))
 	}
 
-	fmt.Printf("Persisting new block to disk:\n")
-	fmt.Printf("\t%s\n", blockFsJson)
+	return nil
+}
 
-	if _, err = state.dbFile.Write(append(blockFsJson, '\n')); err != nil {
-		return Hash{}, err
+// the state.json holds the balances at the latest block, as a human readable cache of the blocks.db
+func (state *State) writeBalancesCache() error {
+	balancesJson, err := json.Marshal(state.balances)
+	if err != nil {
+		return err
 	}
 
-	state.latestBlockHash = blockHash
-	state.txMempool = []Tx{}
+	if err := state.cacheFile.Truncate(0); err != nil {
+		return err
+	}
 
-	return state.latestBlockHash, nil
-}
+	if _, err := state.cacheFile.WriteAt(balancesJson, 0); err != nil {
+		return err
+	}
 
-func (state *State) Close() {
-	state.cacheFile.Close()
-	state.dbFile.Close()
+	return state.cacheFile.Sync()
 }
 
-func (state *State) copy() State {
-	c := State{}
+// copy must be called with the state lock held
+func (state *State) copy() *State {
+	c := &State{}
 	c.hasGenesisBlock = state.hasGenesisBlock
 	c.latestBlock = state.latestBlock
 	c.latestBlockHash = state.latestBlockHash
-	c.txMempool = make([]Tx, len(state.txMempool))
-	c.Balances = make(map[Account]uint)
+	c.txMempool = make([]Tx, 0, len(state.txMempool))
+	c.balances = make(map[Account]uint)
 
-	for acc, balance := range state.Balances {
-		c.Balances[acc] = balance
+	for acc, balance := range state.balances {
+		c.balances[acc] = balance
 	}
 
 	for _, tx := range state.txMempool {
@@ -232,7 +638,7 @@ func (state *State) copy() State {
 
 // applyBlock verifies if a block can be added to the blockchain
 // Block meteada are verified as well as transactions within (sufficient balances, etc...)
-func applyBlock(b Block, s State) error {
+func applyBlock(b Block, s *State) error {
 	nextExpectedBlockNumber := s.latestBlock.Header.Number + 1
 
 	if s.hasGenesisBlock && b.Header.Number != nextExpectedBlockNumber {
@@ -243,25 +649,7 @@ func applyBlock(b Block, s State) error {
 		return fmt.Errorf("next block parent hash must be '%x' not '%x'", s.latestBlockHash, b.Header.Parent)
 	}
 
-	return applyTXs(b.TXs, &s)
-}
-
-// Validating transactions against the current state (valid sender balance)
-// Changing the state
-func (state *State) apply(tx Tx) error {
-	if tx.IsReward() {
-		state.Balances[tx.To] += tx.Value
-		return nil
-	}
-
-	if state.Balances[tx.From] < tx.Value {
-		return fmt.Errorf("insufficient balance")
-	}
-
-	state.Balances[tx.From] -= tx.Value
-	state.Balances[tx.To] += tx.Value
-
-	return nil
+	return applyTXs(b.TXs, s)
 }
 
 func applyTXs(txs []Tx, s *State) error {
@@ -275,27 +663,40 @@ func applyTXs(txs []Tx, s *State) error {
 	return nil
 }
 
+// validateTxs applies every valid tx of txs onto pending, skipping and reporting the invalid ones
+func validateTxs(txs []Tx, pending *State) (*State, []error) {
+	txErrs := make([]error, len(txs))
+	for i, tx := range txs {
+		txErrs[i] = applyTx(tx, pending)
+	}
+
+	return pending, txErrs
+}
+
 func applyTx(tx Tx, s *State) error {
 	if tx.IsReward() {
-		s.Balances[tx.To] += tx.Value
+		s.balances[tx.To] += tx.Value
 		return nil
 	}
 
-	if tx.Value > s.Balances[tx.From] {
-		return fmt.Errorf("Invalid TX. Sender '%s' balance is %d TBB. TX cost is %d TBB", tx.From, s.Balances[tx.From], tx.Value)
+	if tx.Value > s.balances[tx.From] {
+		return fmt.Errorf("Invalid TX. Sender '%s' balance is %d TBB. TX cost is %d TBB", tx.From, s.balances[tx.From], tx.Value)
 	}
 
-	s.Balances[tx.From] -= tx.Value
-	s.Balances[tx.To] += tx.Value
+	s.balances[tx.From] -= tx.Value
+	s.balances[tx.To] += tx.Value
 
 	return nil
 }
 
-func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
+// GetBlocksAfter reads at most limit blocks stored after blockHash, or all of them when limit is 0.
+// It also reports whether more blocks follow the returned ones
+func GetBlocksAfter(blockHash Hash, dataDir string, limit int) ([]Block, bool, error) {
 	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	defer f.Close()
 
 	blocks := make([]Block, 0)
 	shouldStartCollecting := false
@@ -307,16 +708,20 @@ func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		if err := scanner.Err(); err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		var blockFs BlockFS
 		err = json.Unmarshal(scanner.Bytes(), &blockFs)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
 		if shouldStartCollecting {
+			if limit > 0 && len(blocks) == limit {
+				return blocks, true, nil
+			}
+
 			blocks = append(blocks, blockFs.Value)
 			continue
 		}
@@ -326,5 +731,206 @@ func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
 		}
 	}
 
-	return blocks, nil
+	return blocks, false, nil
+}
+
+// HeaderFS is a block header together with the hash of its block
+type HeaderFS struct {
+	Key   Hash        `json:"hash"`
+	Value BlockHeader `json:"header"`
+}
+
+// ErrBlockNotFound is returned by GetHeadersAfter when the block to read after isn't stored
+var ErrBlockNotFound = errors.New("block not found")
+
+// GetHeadersAfter reads at most limit headers of the blocks stored after blockHash, or of all of them
+// from the first block when blockHash is empty. It also reports whether more blocks follow the returned ones
+func GetHeadersAfter(blockHash Hash, dataDir string, limit int) ([]HeaderFS, bool, error) {
+	headers := make([]HeaderFS, 0)
+	collecting := blockHash.IsEmpty()
+	more := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if !collecting {
+			collecting = blockFs.Key == blockHash
+			return true
+		}
+
+		if limit > 0 && len(headers) == limit {
+			more = true
+			return false
+		}
+
+		headers = append(headers, HeaderFS{Key: blockFs.Key, Value: blockFs.Value.Header})
+
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !collecting {
+		return nil, false, ErrBlockNotFound
+	}
+
+	return headers, more, nil
+}
+
+// GetBlocksFrom reads at most limit blocks starting with the block of the given number.
+// It also reports whether more blocks follow the returned ones
+func GetBlocksFrom(number uint64, dataDir string, limit int) ([]BlockFS, bool, error) {
+	blocks := make([]BlockFS, 0)
+	more := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if blockFs.Value.Header.Number < number {
+			return true
+		}
+
+		if limit > 0 && len(blocks) == limit {
+			more = true
+			return false
+		}
+
+		blocks = append(blocks, blockFs)
+
+		return true
+	})
+
+	return blocks, more, err
+}
+
+// VerifyHeaders checks that headers follow each other by number and parent hash, starting right after parent.
+// An empty parent means headers start the chain
+func VerifyHeaders(parent HeaderFS, headers []HeaderFS) error {
+	for i, h := range headers {
+		if i == 0 && parent.Key.IsEmpty() {
+			continue
+		}
+
+		previous := parent
+		if i > 0 {
+			previous = headers[i-1]
+		}
+
+		if h.Value.Number != previous.Value.Number+1 {
+			return &InvalidBlockError{Number: h.Value.Number, Err: fmt.Errorf("header %d follows header %d", h.Value.Number, previous.Value.Number)}
+		}
+
+		if h.Value.Parent != previous.Key {
+			return &InvalidBlockError{Number: h.Value.Number, Err: fmt.Errorf("header %d parent must be '%x' not '%x'", h.Value.Number, previous.Key, h.Value.Parent)}
+		}
+	}
+
+	return nil
+}
+
+// GetBlockByHash scans the blocks.db for the block stored under the given hash
+func GetBlockByHash(blockHash Hash, dataDir string) (BlockFS, bool, error) {
+	found := BlockFS{}
+	ok := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if blockFs.Key == blockHash {
+			found = blockFs
+			ok = true
+			return false
+		}
+
+		return true
+	})
+
+	return found, ok, err
+}
+
+// GetBlockByNumber scans the blocks.db for the block with the given height
+func GetBlockByNumber(number uint64, dataDir string) (BlockFS, bool, error) {
+	found := BlockFS{}
+	ok := false
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		if blockFs.Value.Header.Number == number {
+			found = blockFs
+			ok = true
+			return false
+		}
+
+		return true
+	})
+
+	return found, ok, err
+}
+
+// TxFS is a transaction together with the block it was included in
+type TxFS struct {
+	Key         Hash   `json:"hash"`
+	Value       Tx     `json:"tx"`
+	BlockHash   Hash   `json:"block_hash"`
+	BlockNumber uint64 `json:"block_number"`
+}
+
+// GetTx scans the blocks.db for the first transaction with the given hash
+func GetTx(txHash Hash, dataDir string) (TxFS, bool, error) {
+	found := TxFS{}
+	ok := false
+	var txErr error
+
+	err := forEachBlock(dataDir, func(blockFs BlockFS) bool {
+		for _, tx := range blockFs.Value.TXs {
+			hash, err := tx.Hash()
+			if err != nil {
+				txErr = err
+				return false
+			}
+
+			if hash == txHash {
+				found = TxFS{
+					Key:         hash,
+					Value:       tx,
+					BlockHash:   blockFs.Key,
+					BlockNumber: blockFs.Value.Header.Number,
+				}
+				ok = true
+				return false
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		return TxFS{}, false, err
+	}
+	if txErr != nil {
+		return TxFS{}, false, txErr
+	}
+
+	return found, ok, nil
+}
+
+// forEachBlock calls fn with every block stored in the blocks.db, in order, until fn returns false
+func forEachBlock(dataDir string, fn func(BlockFS) bool) error {
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(scanner.Bytes(), &blockFs)
+		if err != nil {
+			return err
+		}
+
+		if !fn(blockFs) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
 }
@@ -1,5 +1,11 @@
 package database
 
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+)
+
 // each customer in the database is represented by an account struct
 type Account string
 
@@ -8,11 +14,13 @@ func NewAccount(value string) Account {
 }
 
 // each transaction has a from, to, value, and data
+// the time is when the transaction was created, in unix nanoseconds, so identical transfers get different hashes
 type Tx struct {
 	From  Account `json:"from"`
 	To    Account `json:"to"`
 	Value uint    `json:"value"`
 	Data  string  `json:"data"`
+	Time  uint64  `json:"time,omitempty"`
 }
 
 func NewTx(from Account, to Account, value uint, data string) Tx {
@@ -21,6 +29,7 @@ func NewTx(from Account, to Account, value uint, data string) Tx {
 		To:    to,
 		Value: value,
 		Data:  data,
+		Time:  uint64(time.Now().UnixNano()),
 	}
 }
 
@@ -28,3 +37,13 @@ func NewTx(from Account, to Account, value uint, data string) Tx {
 func (t Tx) IsReward() bool {
 	return t.Data == "reward"
 }
+
+// the hash of a transaction is the sha256 of its json encoding
+func (t Tx) Hash() (Hash, error) {
+	txJson, err := json.Marshal(t)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(txJson), nil
+}
@@ -32,24 +32,84 @@ func balancesListCmd() *cobra.Command {
 		Short: "Lists all balances.",
 		Run: func(cmd *cobra.Command, args []string) {
 			dataDir, _ := cmd.Flags().GetString(flagDataDir)
-			state, err := database.NewStateFromDisk(dataDir)
+
+			q, err := balancesQueryFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			// listing only reads the data dir, a node running on it keeps its files to itself
+			state, err := database.NewStateFromDiskReadOnly(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			snapshot := state.Snapshot()
+
+			err = state.Close()
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
-			defer state.Close()
 
-			fmt.Printf("Accounts Balances at %x:\n", state.LatestBlockHash())
+			page, err := database.QueryBalances(snapshot.Balances, q)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Accounts Balances at %x:\n", snapshot.LatestBlockHash)
 			fmt.Println("-------------------")
 			fmt.Println("")
 
-			for account, balance := range state.Balances {
-				fmt.Println(fmt.Sprintf("%s: %d", account, balance))
+			for _, b := range page.Balances {
+				fmt.Println(fmt.Sprintf("%s: %d", b.Account, b.Balance))
+			}
+
+			fmt.Println("")
+			fmt.Printf("%d of %d accounts matched, total supply %d TBB\n", page.Matched, page.AccountCount, page.TotalSupply)
+			if page.NextCursor != "" {
+				fmt.Printf("Next page: --%s %s\n", flagCursor, page.NextCursor)
 			}
 		},
 	}
 
 	addDefaultRequiredFlags(balancesListCmd)
+	balancesListCmd.Flags().String(flagSort, database.SortByName, "sort the balances by 'name' or 'amount'")
+	balancesListCmd.Flags().Bool(flagDesc, false, "sort in descending order")
+	balancesListCmd.Flags().Int(flagLimit, 0, "maximum number of balances listed, 0 for all of them")
+	balancesListCmd.Flags().String(flagCursor, "", "cursor of the page to list, as printed after the previous page")
+	balancesListCmd.Flags().Uint(flagMinBalance, 0, "leave out balances below this amount")
+	balancesListCmd.Flags().StringArray(flagAccount, nil, "only list this account, repeatable")
 
 	return balancesListCmd
 }
+
+func balancesQueryFromCmd(cmd *cobra.Command) (database.BalancesQuery, error) {
+	sortBy, _ := cmd.Flags().GetString(flagSort)
+	desc, _ := cmd.Flags().GetBool(flagDesc)
+	limit, _ := cmd.Flags().GetInt(flagLimit)
+	cursor, _ := cmd.Flags().GetString(flagCursor)
+	minBalance, _ := cmd.Flags().GetUint(flagMinBalance)
+	rawAccounts, _ := cmd.Flags().GetStringArray(flagAccount)
+
+	if limit < 0 {
+		return database.BalancesQuery{}, fmt.Errorf("invalid --%s %d", flagLimit, limit)
+	}
+
+	accounts := make([]database.Account, len(rawAccounts))
+	for i, account := range rawAccounts {
+		accounts[i] = database.NewAccount(account)
+	}
+
+	return database.BalancesQuery{
+		SortBy:     sortBy,
+		Desc:       desc,
+		Limit:      limit,
+		Cursor:     cursor,
+		MinBalance: minBalance,
+		Accounts:   accounts,
+	}, nil
+}
@@ -12,6 +12,44 @@ import (
 const flagDataDir = "datadir"
 const flagIP = "ip"
 const flagPort = "port"
+const flagTCPPort = "tcp-port"
+const flagAuthToken = "auth-token"
+const flagAuthHMACSecret = "auth-hmac-secret"
+const flagAuthPolicy = "auth-policy"
+const flagPeerAuthToken = "peer-auth-token"
+const flagInsecureNoAuth = "insecure-no-auth"
+const flagMaxBodyBytes = "max-body-bytes"
+const flagMaxSyncBlocks = "max-sync-blocks"
+const flagMaxSyncHeaders = "max-sync-headers"
+const flagRateLimit = "rate-limit"
+const flagTLSCert = "tls-cert"
+const flagTLSKey = "tls-key"
+const flagTLSCA = "tls-ca"
+const flagTLSPin = "tls-pin"
+const flagReadyMaxBlocksBehind = "ready-max-blocks-behind"
+const flagReadyMinPeers = "ready-min-peers"
+const flagReadyMaxFailedSyncs = "ready-max-failed-syncs"
+const flagCORSOrigin = "cors-origin"
+const flagPeerMaxAge = "peer-max-age"
+const flagPeerBanScore = "peer-ban-score"
+const flagPeerBanDuration = "peer-ban-duration"
+const flagBootstrap = "bootstrap"
+const flagSeedsFile = "seeds-file"
+const flagSeedResolveInterval = "seed-resolve-interval"
+const flagDiscovery = "discovery"
+const flagDiscoveryPort = "discovery-port"
+const flagDiscoveryAddr = "discovery-addr"
+const flagDiscoveryInterval = "discovery-interval"
+const flagSyncInterval = "sync-interval"
+const flagSyncWorkers = "sync-workers"
+const flagSyncRequestTimeout = "sync-request-timeout"
+const flagSyncPeerTimeout = "sync-peer-timeout"
+const flagSort = "sort"
+const flagDesc = "desc"
+const flagLimit = "limit"
+const flagCursor = "cursor"
+const flagMinBalance = "min-balance"
+const flagAccount = "account"
 
 func main() {
 	var tbbCmd = &cobra.Command{
@@ -25,6 +63,8 @@ func main() {
 	tbbCmd.AddCommand(balancesCmd())
 	tbbCmd.AddCommand(runCmd())
 	tbbCmd.AddCommand(migrateCmd())
+	tbbCmd.AddCommand(tlsCmd())
+	tbbCmd.AddCommand(nodeCmd())
 
 	err := tbbCmd.Execute()
 	if err != nil {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/node"
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	"github.com/spf13/cobra"
+)
+
+const flagNodeAddr = "node"
+const flagNodeTimeout = "timeout"
+
+// a sync round with many peers, or a long catch up, takes much longer than a single request
+const defaultSyncNowTimeout = 5 * time.Minute
+
+// administration of a running node through its HTTP API
+func nodeCmd() *cobra.Command {
+	var nodeCmd = &cobra.Command{
+		Use:   "node",
+		Short: "Administer a running node (sync-now...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	nodeCmd.AddCommand(nodeSyncNowCmd())
+
+	return nodeCmd
+}
+
+func nodeSyncNowCmd() *cobra.Command {
+	var syncNowCmd = &cobra.Command{
+		Use:   "sync-now",
+		Short: "Makes the node sync with its peers right away and prints how it went with each.",
+		Run: func(cmd *cobra.Command, args []string) {
+			timeout, _ := cmd.Flags().GetDuration(flagNodeTimeout)
+
+			nodeClient, err := nodeClientFromCmd(cmd, client.WithTimeout(timeout))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			res, err := nodeClient.SyncNow(context.Background())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Synced in %s, now at block %d %x\n", res.Duration, res.Number, res.Hash)
+			fmt.Println("-------------------")
+			fmt.Println("")
+
+			for _, peer := range res.Peers {
+				switch {
+				case peer.Skipped != "":
+					fmt.Printf("%s: skipped, %s\n", peer.Peer, peer.Skipped)
+				case peer.Error != "":
+					fmt.Printf("%s: failed, %s\n", peer.Peer, peer.Error)
+				default:
+					fmt.Printf("%s: at block %d, %d blocks imported, %d peers discovered\n", peer.Peer, peer.Number, peer.BlocksImported, peer.PeersDiscovered)
+				}
+			}
+
+			fmt.Println("")
+			fmt.Printf("%d blocks imported and %d peers discovered from %d peers\n", res.BlocksImported, res.PeersDiscovered, len(res.Peers))
+		},
+	}
+
+	addNodeClientFlags(syncNowCmd)
+	syncNowCmd.Flags().Duration(flagNodeTimeout, defaultSyncNowTimeout, "how long to wait for the sync round to complete")
+
+	return syncNowCmd
+}
+
+func addNodeClientFlags(cmd *cobra.Command) {
+	cmd.Flags().String(flagNodeAddr, fmt.Sprintf("%s:%d", node.DefaultIP, node.DefaultHTTPort), "node to administer, as 'ip:port' or a base URL such as 'https://host:port'")
+	cmd.Flags().String(flagAuthToken, "", "API token of the node")
+	cmd.Flags().String(flagAuthHMACSecret, "", "secret to sign the requests with, when the node verifies signatures")
+	cmd.Flags().String(flagTLSCA, "", "PEM bundle of private CAs trusted when the node serves HTTPS")
+	cmd.Flags().StringArray(flagTLSPin, nil, "SHA-256 fingerprint of the node certificate to trust, repeatable")
+}
+
+func nodeClientFromCmd(cmd *cobra.Command, opts ...client.Option) (*client.Client, error) {
+	addr, _ := cmd.Flags().GetString(flagNodeAddr)
+	token, _ := cmd.Flags().GetString(flagAuthToken)
+	hmacSecret, _ := cmd.Flags().GetString(flagAuthHMACSecret)
+	tlsCA, _ := cmd.Flags().GetString(flagTLSCA)
+	tlsPins, _ := cmd.Flags().GetStringArray(flagTLSPin)
+
+	opts = append([]client.Option{client.WithToken(token)}, opts...)
+
+	if hmacSecret != "" {
+		opts = append(opts, client.WithHMACSecret([]byte(hmacSecret)))
+	}
+
+	if tlsCA != "" || len(tlsPins) > 0 {
+		tlsConfig, err := client.NewTLSConfig(tlsCA, tlsPins)
+		if err != nil {
+			return nil, err
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+
+	return client.New(addr, opts...), nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/mycicle/MyChain/blockchain/node"
 	"github.com/spf13/cobra"
@@ -16,18 +20,114 @@ func runCmd() *cobra.Command {
 			dataDir, _ := cmd.Flags().GetString(flagDataDir)
 			ip, _ := cmd.Flags().GetString(flagIP)
 			port, _ := cmd.Flags().GetUint64(flagPort)
+			tcpPort, _ := cmd.Flags().GetUint64(flagTCPPort)
+
+			auth, err := authConfigFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			insecureNoAuth, _ := cmd.Flags().GetBool(flagInsecureNoAuth)
+			if !auth.Enabled() && !insecureNoAuth {
+				fmt.Fprintf(os.Stderr, "no API token nor HMAC secret configured: pass --%s or --%s, or --%s to serve every route publicly\n", flagAuthToken, flagAuthHMACSecret, flagInsecureNoAuth)
+				os.Exit(1)
+			}
+
+			limits, err := limitsFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			seeds, err := seedsFromCmd(cmd)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			tlsCert, _ := cmd.Flags().GetString(flagTLSCert)
+			tlsKey, _ := cmd.Flags().GetString(flagTLSKey)
+			tlsCA, _ := cmd.Flags().GetString(flagTLSCA)
+			tlsPins, _ := cmd.Flags().GetStringArray(flagTLSPin)
+
+			readyMaxBlocksBehind, _ := cmd.Flags().GetUint64(flagReadyMaxBlocksBehind)
+			readyMinPeers, _ := cmd.Flags().GetInt(flagReadyMinPeers)
+			readyMaxFailedSyncs, _ := cmd.Flags().GetInt(flagReadyMaxFailedSyncs)
+
+			corsOrigins, _ := cmd.Flags().GetStringArray(flagCORSOrigin)
+			peerMaxAge, _ := cmd.Flags().GetDuration(flagPeerMaxAge)
+			seedResolveInterval, _ := cmd.Flags().GetDuration(flagSeedResolveInterval)
+			peerBanScore, _ := cmd.Flags().GetInt(flagPeerBanScore)
+			peerBanDuration, _ := cmd.Flags().GetDuration(flagPeerBanDuration)
+
+			discovery, _ := cmd.Flags().GetBool(flagDiscovery)
+			discoveryPort, _ := cmd.Flags().GetUint64(flagDiscoveryPort)
+			discoveryAddr, _ := cmd.Flags().GetString(flagDiscoveryAddr)
+			discoveryInterval, _ := cmd.Flags().GetDuration(flagDiscoveryInterval)
+
+			syncInterval, _ := cmd.Flags().GetDuration(flagSyncInterval)
+			syncWorkers, _ := cmd.Flags().GetInt(flagSyncWorkers)
+			syncRequestTimeout, _ := cmd.Flags().GetDuration(flagSyncRequestTimeout)
+			syncPeerTimeout, _ := cmd.Flags().GetDuration(flagSyncPeerTimeout)
+
+			scoring := node.DefaultPeerScoring()
+			scoring.BanScore = peerBanScore
+			scoring.BanDuration = peerBanDuration
 
 			fmt.Println("Launching TBB node and its HTTP API...")
 
-			bootstrap := node.NewPeerNode(
-				"127.0.0.1",
-				8080,
-				true,
-				false,
-			)
+			if len(seeds) == 0 && !discovery {
+				fmt.Println("No bootstrap peer configured, only syncing with the peers already known or joining this node")
+			}
+
+			// stop the node cleanly on Ctrl+C or when the process is asked to terminate
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			opts := []node.Option{
+				node.WithIP(ip),
+				node.WithPort(port),
+				node.WithSeeds(seeds...),
+				node.WithSeedResolveInterval(seedResolveInterval),
+				node.WithPeerMaxAge(peerMaxAge),
+				node.WithPeerScoring(scoring),
+				node.WithSync(node.SyncConfig{
+					Interval:       syncInterval,
+					Workers:        syncWorkers,
+					RequestTimeout: syncRequestTimeout,
+					PeerTimeout:    syncPeerTimeout,
+				}),
+				node.WithAuth(auth),
+				node.WithLimits(limits),
+				node.WithTLS(node.TLSConfig{
+					CertFile:    tlsCert,
+					KeyFile:     tlsKey,
+					CAFile:      tlsCA,
+					PinnedCerts: tlsPins,
+				}),
+				node.WithReadiness(node.ReadinessConfig{
+					MaxBlocksBehind:     readyMaxBlocksBehind,
+					MinConnectedPeers:   readyMinPeers,
+					MaxFailedSyncRounds: readyMaxFailedSyncs,
+				}),
+				node.WithCORS(node.CORSConfig{AllowedOrigins: corsOrigins}),
+			}
+
+			if tcpPort > 0 {
+				opts = append(opts, node.WithTCP(tcpPort))
+			}
+
+			if discovery {
+				opts = append(opts, node.WithDiscovery(node.DiscoveryConfig{
+					Port:     discoveryPort,
+					Addr:     discoveryAddr,
+					Interval: discoveryInterval,
+				}))
+			}
 
-			n := node.New(dataDir, ip, port, bootstrap)
-			err := n.Run()
+			n := node.New(dataDir, opts...)
+			err = n.Run(ctx)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
@@ -38,6 +138,121 @@ func runCmd() *cobra.Command {
 	addDefaultRequiredFlags(runCmd)
 	runCmd.Flags().String(flagIP, node.DefaultIP, "exposed IP for communication with peers")
 	runCmd.Flags().Uint64(flagPort, node.DefaultHTTPort, "exposed HTTP port for communication with peers")
+	runCmd.Flags().Uint64(flagTCPPort, 0, "port of the binary TCP transport syncing and gossiping with the peers which serve one too, 0 to only speak HTTP")
+	runCmd.Flags().StringArray(flagAuthToken, nil, "API token accepted on protected routes, repeatable")
+	runCmd.Flags().String(flagAuthHMACSecret, "", "secret shared by the network to sign and verify requests between nodes, requests are only signed for bootstrap peers and peers which joined with valid credentials")
+	runCmd.Flags().StringArray(flagAuthPolicy, nil, "access policy of a route or JSON-RPC method as 'route=public' or 'route=auth', repeatable")
+	runCmd.Flags().Bool(flagInsecureNoAuth, false, "start without any API token nor HMAC secret, every route being public")
+	runCmd.Flags().String(flagPeerAuthToken, "", "API token presented on the protected routes of bootstrap peers and peers which joined with valid credentials")
+	runCmd.Flags().Int64(flagMaxBodyBytes, node.DefaultMaxBodyBytes, "maximum size in bytes of a request body, 0 for no limit")
+	runCmd.Flags().Int(flagMaxSyncBlocks, node.DefaultMaxSyncBlocks, "maximum number of blocks sent to a peer in a single sync response")
+	runCmd.Flags().Int(flagMaxSyncHeaders, node.DefaultMaxSyncHeaders, "maximum number of headers sent to a peer in a single sync response")
+	runCmd.Flags().StringArray(flagRateLimit, nil, "per IP rate limit of a route as 'route=perSecond:burst', repeatable")
+	runCmd.Flags().String(flagTLSCert, "", "PEM certificate to serve the HTTP API over TLS, peers are then reached over HTTPS")
+	runCmd.Flags().String(flagTLSKey, "", "PEM private key of --tls-cert")
+	runCmd.Flags().String(flagTLSCA, "", "PEM bundle of private CAs trusted when connecting to peers")
+	runCmd.Flags().StringArray(flagTLSPin, nil, "SHA-256 fingerprint of a peer certificate to trust, repeatable")
+	runCmd.Flags().Uint64(flagReadyMaxBlocksBehind, node.DefaultMaxBlocksBehind, "/readyz fails when the node is more blocks behind its best peer")
+	runCmd.Flags().Int(flagReadyMinPeers, node.DefaultMinConnectedPeers, "/readyz fails with fewer connected peers, 0 for a standalone node")
+	runCmd.Flags().Int(flagReadyMaxFailedSyncs, node.DefaultMaxFailedSyncRounds, "/readyz fails after this many sync rounds in a row failed, 0 to ignore")
+	runCmd.Flags().StringArray(flagBootstrap, nil, "bootstrap peer as 'ip:port' or 'host:port', repeatable. Without any the node starts a new network")
+	runCmd.Flags().String(flagSeedsFile, "", "file listing a bootstrap peer per line, as --bootstrap does")
+	runCmd.Flags().Duration(flagSeedResolveInterval, node.DefaultSeedResolveInterval, "how often the hostnames of bootstrap peers are resolved again, 0 to only resolve them at startup")
+	runCmd.Flags().Bool(flagDiscovery, false, "announce the node over UDP on the local network and add the nodes of the same chain announcing themselves as peers")
+	runCmd.Flags().Uint64(flagDiscoveryPort, node.DefaultDiscoveryPort, "UDP port every node of the local network announces itself on")
+	runCmd.Flags().String(flagDiscoveryAddr, node.DefaultDiscoveryAddr, "broadcast address, e.g. 192.168.1.255 or 127.255.255.255 for the nodes of this host, or multicast group the announcements are sent to")
+	runCmd.Flags().Duration(flagDiscoveryInterval, node.DefaultDiscoveryInterval, "time between two announcements on the local network")
+	runCmd.Flags().Duration(flagSyncInterval, node.DefaultSyncInterval, "time between two sync rounds with the peers, see 'tbb node sync-now' to run one in between")
+	runCmd.Flags().Int(flagSyncWorkers, node.DefaultSyncWorkers, "number of peers queried, and of block batches downloaded, at the same time")
+	runCmd.Flags().Duration(flagSyncRequestTimeout, node.DefaultSyncRequestTimeout, "timeout of every single request to a peer")
+	runCmd.Flags().Duration(flagSyncPeerTimeout, node.DefaultSyncPeerTimeout, "how long querying and joining a single peer, and each download of its headers, may take during a sync round")
+	runCmd.Flags().Duration(flagPeerMaxAge, node.DefaultPeerMaxAge, "known peers not seen for longer are forgotten, 0 to keep them forever")
+	runCmd.Flags().Int(flagPeerBanScore, node.DefaultBanScore, "peers whose score drops to this value are banned")
+	runCmd.Flags().Duration(flagPeerBanDuration, node.DefaultBanDuration, "how long a peer stays banned")
+	runCmd.Flags().StringArray(flagCORSOrigin, nil, "origin of browser clients allowed to call the API, or '*' for any, repeatable")
 
 	return runCmd
 }
+
+func authConfigFromCmd(cmd *cobra.Command) (node.AuthConfig, error) {
+	tokens, _ := cmd.Flags().GetStringArray(flagAuthToken)
+	hmacSecret, _ := cmd.Flags().GetString(flagAuthHMACSecret)
+	rawPolicies, _ := cmd.Flags().GetStringArray(flagAuthPolicy)
+	peerToken, _ := cmd.Flags().GetString(flagPeerAuthToken)
+
+	auth := node.AuthConfig{
+		Tokens:        tokens,
+		PeerToken:     peerToken,
+		RoutePolicies: make(map[string]node.Policy),
+		RPCPolicies:   make(map[string]node.Policy),
+	}
+
+	if hmacSecret != "" {
+		auth.HMACSecret = []byte(hmacSecret)
+	}
+
+	// routes start with a slash, anything else names a JSON-RPC method
+	for _, rawPolicy := range rawPolicies {
+		route, policy, err := node.ParsePolicy(rawPolicy)
+		if err != nil {
+			return node.AuthConfig{}, err
+		}
+
+		if strings.HasPrefix(route, "/") {
+			auth.RoutePolicies[route] = policy
+		} else {
+			auth.RPCPolicies[route] = policy
+		}
+	}
+
+	return auth, nil
+}
+
+func limitsFromCmd(cmd *cobra.Command) (node.Limits, error) {
+	maxBodyBytes, _ := cmd.Flags().GetInt64(flagMaxBodyBytes)
+	maxSyncBlocks, _ := cmd.Flags().GetInt(flagMaxSyncBlocks)
+	maxSyncHeaders, _ := cmd.Flags().GetInt(flagMaxSyncHeaders)
+	rawRates, _ := cmd.Flags().GetStringArray(flagRateLimit)
+
+	limits := node.DefaultLimits()
+	limits.MaxBodyBytes = maxBodyBytes
+	limits.MaxSyncBlocks = maxSyncBlocks
+	limits.MaxSyncHeaders = maxSyncHeaders
+
+	for _, rawRate := range rawRates {
+		route, rate, err := node.ParseRate(rawRate)
+		if err != nil {
+			return node.Limits{}, err
+		}
+
+		limits.RouteRates[route] = rate
+	}
+
+	return limits, nil
+}
+
+func seedsFromCmd(cmd *cobra.Command) ([]node.Seed, error) {
+	rawSeeds, _ := cmd.Flags().GetStringArray(flagBootstrap)
+	seedsFile, _ := cmd.Flags().GetString(flagSeedsFile)
+
+	seeds := make([]node.Seed, 0)
+	for _, rawSeed := range rawSeeds {
+		seed, err := node.ParseSeed(rawSeed)
+		if err != nil {
+			return nil, err
+		}
+
+		seeds = append(seeds, seed)
+	}
+
+	if seedsFile != "" {
+		fileSeeds, err := node.LoadSeedsFile(seedsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		seeds = append(seeds, fileSeeds...)
+	}
+
+	return seeds, nil
+}
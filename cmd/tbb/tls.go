@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mycicle/MyChain/blockchain/fs"
+	"github.com/mycicle/MyChain/blockchain/node/client"
+	"github.com/spf13/cobra"
+)
+
+const flagTLSHost = "host"
+const flagTLSOut = "out"
+const flagTLSDays = "days"
+
+// helpers to secure the HTTP API of the nodes with TLS
+func tlsCmd() *cobra.Command {
+	var tlsCmd = &cobra.Command{
+		Use:   "tls",
+		Short: "Manage TLS certificates (gen...)",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	tlsCmd.AddCommand(tlsGenCmd())
+
+	return tlsCmd
+}
+
+func tlsGenCmd() *cobra.Command {
+	var tlsGenCmd = &cobra.Command{
+		Use:   "gen",
+		Short: "Generates a self-signed certificate for the nodes of a local network.",
+		Run: func(cmd *cobra.Command, args []string) {
+			hosts, _ := cmd.Flags().GetStringArray(flagTLSHost)
+			out, _ := cmd.Flags().GetString(flagTLSOut)
+			days, _ := cmd.Flags().GetInt(flagTLSDays)
+
+			certPath, keyPath, fingerprint, err := writeSelfSignedCert(fs.ExpandPath(out), hosts, days)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Certificate: %s\n", certPath)
+			fmt.Printf("Private key: %s\n", keyPath)
+			fmt.Printf("SHA-256 fingerprint, to pass to --%s: %s\n", flagTLSPin, fingerprint)
+		},
+	}
+
+	tlsGenCmd.Flags().StringArray(flagTLSHost, []string{"127.0.0.1", "localhost"}, "IP or hostname the certificate is valid for, repeatable")
+	tlsGenCmd.Flags().String(flagTLSOut, ".", "directory to write cert.pem and key.pem into")
+	tlsGenCmd.Flags().Int(flagTLSDays, 365, "number of days the certificate is valid for")
+
+	return tlsGenCmd
+}
+
+// the certificate can sign itself only, so it is both the leaf served by the nodes and the CA trusting it
+func writeSelfSignedCert(dir string, hosts []string, days int) (string, string, string, error) {
+	if len(hosts) == 0 {
+		return "", "", "", fmt.Errorf("at least one --%s is required", flagTLSHost)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", "", err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"The Blockchain Bar"}, CommonName: hosts[0]},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(0, 0, days),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", "", "", err
+	}
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return certPath, keyPath, client.CertFingerprint(der), nil
+}